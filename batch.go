@@ -0,0 +1,115 @@
+package commcid
+
+import (
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/multiformats/go-varint"
+	"golang.org/x/xerrors"
+)
+
+// DataCommitmentsV1ToCIDs converts a batch of raw data commitments to CIDs, as
+// DataCommitmentV1ToCID does for one. Every commitment is validated before
+// any CID is built, and the error names the index of the first invalid one.
+func DataCommitmentsV1ToCIDs(commitments [][]byte) ([]cid.Cid, error) {
+	return commitmentsToCIDs(cid.FilCommitmentUnsealed, multihash.SHA2_256_TRUNC254_PADDED, validateTruncatedDigest, commitments)
+}
+
+// ReplicaCommitmentsV1ToCIDs converts a batch of raw replica commitments to
+// CIDs, as ReplicaCommitmentV1ToCID does for one. Every commitment is
+// validated before any CID is built, and the error names the index of the
+// first invalid one.
+func ReplicaCommitmentsV1ToCIDs(commitments [][]byte) ([]cid.Cid, error) {
+	return commitmentsToCIDs(cid.FilCommitmentSealed, multihash.POSEIDON_BLS12_381_A1_FC1, validateFieldElement, commitments)
+}
+
+// commitmentsToCIDs validates all commitments, applying check to each if set,
+// and then builds their CIDs through a single multihash buffer, which NewCidV1
+// copies out of
+func commitmentsToCIDs(mc FilMultiCodec, mh FilMultiHash, check func([]byte) error, commitments [][]byte) ([]cid.Cid, error) {
+	for i, commX := range commitments {
+		err := validateFilecoinCidSegments(mc, mh, commX)
+		if err == nil && check != nil {
+			err = check(commX)
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("commitment %d: %w", i, err)
+		}
+	}
+
+	mhBuf := make([]byte, varint.UvarintSize(uint64(mh))+varint.UvarintSize(nodeSize)+nodeSize)
+	pos := varint.PutUvarint(mhBuf, uint64(mh))
+	pos += varint.PutUvarint(mhBuf[pos:], nodeSize)
+
+	cids := make([]cid.Cid, len(commitments))
+	for i, commX := range commitments {
+		copy(mhBuf[pos:], commX)
+		cids[i] = cid.NewCidV1(uint64(mc), multihash.Multihash(mhBuf))
+	}
+	return cids, nil
+}
+
+// V1PieceEntry is a v1 piece CID together with the size of the unpadded data
+// it commits to, which the CID itself does not carry
+type V1PieceEntry struct {
+	CID          cid.Cid
+	UnpaddedSize uint64
+}
+
+// UpgradeV1PieceCIDs converts a batch of v1 piece CIDs and their sizes to v2
+// piece CIDs, as ConvertDataCommitmentV1V1CIDtoPieceMhCID does for one. The
+// error names the index of the first entry that fails.
+func UpgradeV1PieceCIDs(entries []V1PieceEntry) ([]cid.Cid, error) {
+	cids := make([]cid.Cid, len(entries))
+	commD := make([]byte, nodeSize)
+	for i, e := range entries {
+		c, err := upgradeV1PieceCID(commD, e)
+		if err != nil {
+			return nil, xerrors.Errorf("entry %d: %w", i, err)
+		}
+		cids[i] = c
+	}
+	return cids, nil
+}
+
+// UpgradeV1PieceCIDsPartial is UpgradeV1PieceCIDs converting every entry it
+// can: cids[i] and errs[i] describe entries[i], with cids[i] undefined
+// whenever errs[i] is set
+func UpgradeV1PieceCIDsPartial(entries []V1PieceEntry) ([]cid.Cid, []error) {
+	cids := make([]cid.Cid, len(entries))
+	errs := make([]error, len(entries))
+	commD := make([]byte, nodeSize)
+	for i, e := range entries {
+		c, err := upgradeV1PieceCID(commD, e)
+		if err != nil {
+			errs[i] = xerrors.Errorf("entry %d: %w", i, err)
+			continue
+		}
+		cids[i] = c
+	}
+	return cids, errs
+}
+
+// upgradeV1PieceCID converts one entry, decoding its commitment into commD
+func upgradeV1PieceCID(commD []byte, e V1PieceEntry) (cid.Cid, error) {
+	if err := CIDToDataCommitmentV1Into(commD, e.CID); err != nil {
+		return cid.Undef, err
+	}
+	return DataCommitmentV1ToPieceMhCID(commD, e.UnpaddedSize)
+}
+
+// DowngradeToV1PieceCIDs converts a batch of v2 piece CIDs to v1 piece CIDs
+// and the unpadded sizes they drop, as ConvertDataCommitmentV1PieceMhCIDToV1CID
+// does for one. sizes[i] belongs to cids[i], and the error names the index of
+// the first CID that is not a valid v2 piece CID.
+func DowngradeToV1PieceCIDs(v2cids []cid.Cid) (cids []cid.Cid, sizes []uint64, err error) {
+	cids = make([]cid.Cid, len(v2cids))
+	sizes = make([]uint64, len(v2cids))
+	for i, c := range v2cids {
+		v1, size, err := ConvertDataCommitmentV1PieceMhCIDToV1CID(c)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("piece CID %d: %w", i, err)
+		}
+		cids[i], sizes[i] = v1, size
+	}
+	return cids, sizes, nil
+}
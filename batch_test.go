@@ -0,0 +1,118 @@
+package commcid_test
+
+import (
+	"crypto/rand"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func testRandomCommitments(t *testing.T, n int) [][]byte {
+	commitments := make([][]byte, n)
+	for i := range commitments {
+		commitments[i] = make([]byte, 32)
+		_, err := rand.Read(commitments[i])
+		require.NoError(t, err)
+		commitments[i][31] &= 0x3f
+	}
+	return commitments
+}
+
+func TestDataCommitmentsV1ToCIDs(t *testing.T) {
+	commitments := testRandomCommitments(t, 10)
+	cids, err := commcid.DataCommitmentsV1ToCIDs(commitments)
+	require.NoError(t, err)
+	require.Len(t, cids, len(commitments))
+	for i, commD := range commitments {
+		expected, err := commcid.DataCommitmentV1ToCID(commD)
+		require.NoError(t, err)
+		require.Equal(t, expected, cids[i])
+	}
+
+	t.Run("error names the first invalid commitment", func(t *testing.T) {
+		commitments := append(commitments, make([]byte, 31), make([]byte, 33))
+		cids, err := commcid.DataCommitmentsV1ToCIDs(commitments)
+		require.EqualError(t, err, "commitment 10: commitments must be 32 bytes long, got 31")
+		require.Nil(t, cids)
+	})
+
+	t.Run("error on top bits set", func(t *testing.T) {
+		invalid := testRandomCommitments(t, 1)[0]
+		invalid[31] |= 0x80
+		_, err := commcid.DataCommitmentsV1ToCIDs(append(commitments, invalid))
+		require.ErrorIs(t, err, commcid.ErrInvalidTruncatedDigest)
+		require.EqualError(t, err, "commitment 10: truncated digest has its two most significant bits set")
+	})
+}
+
+func TestReplicaCommitmentsV1ToCIDs(t *testing.T) {
+	commitments := testRandomCommitments(t, 10)
+	cids, err := commcid.ReplicaCommitmentsV1ToCIDs(commitments)
+	require.NoError(t, err)
+	require.Len(t, cids, len(commitments))
+	for i, commR := range commitments {
+		expected, err := commcid.ReplicaCommitmentV1ToCID(commR)
+		require.NoError(t, err)
+		require.Equal(t, expected, cids[i])
+	}
+
+	_, err = commcid.ReplicaCommitmentsV1ToCIDs([][]byte{commitments[0], nil})
+	require.EqualError(t, err, "commitment 1: commitments must be 32 bytes long, got 0")
+}
+
+func TestUpgradeV1PieceCIDs(t *testing.T) {
+	entries := []commcid.V1PieceEntry{
+		{CID: cid.MustParse(fixture32GiBEmptyV1), UnpaddedSize: fixture32GiBUnpadded},
+		{CID: cid.MustParse(fixture127OfEach0123PieceCID), UnpaddedSize: 508},
+	}
+	cids, err := commcid.UpgradeV1PieceCIDs(entries)
+	require.NoError(t, err)
+	require.Len(t, cids, 2)
+	require.Equal(t, fixture32GiBEmptyV2, cids[0].String())
+	for i, e := range entries {
+		expected, err := commcid.ConvertDataCommitmentV1V1CIDtoPieceMhCID(e.CID, e.UnpaddedSize)
+		require.NoError(t, err)
+		require.Equal(t, expected, cids[i])
+	}
+
+	invalid := append(entries,
+		commcid.V1PieceEntry{CID: cid.MustParse(fixture32GiBEmptyV2), UnpaddedSize: fixture32GiBUnpadded},
+		commcid.V1PieceEntry{CID: cid.MustParse(fixture32GiBEmptyV1), UnpaddedSize: 126},
+	)
+	_, err = commcid.UpgradeV1PieceCIDs(invalid)
+	require.ErrorIs(t, err, commcid.ErrIncorrectCodec)
+	require.Regexp(t, "^entry 2: ", err.Error())
+
+	t.Run("partial results", func(t *testing.T) {
+		cids, errs := commcid.UpgradeV1PieceCIDsPartial(invalid)
+		require.Len(t, cids, 4)
+		require.Len(t, errs, 4)
+		require.NoError(t, errs[0])
+		require.NoError(t, errs[1])
+		require.Equal(t, fixture32GiBEmptyV2, cids[0].String())
+		require.ErrorIs(t, errs[2], commcid.ErrIncorrectCodec)
+		require.Equal(t, cid.Undef, cids[2])
+		require.EqualError(t, errs[3], "entry 3: unpadded piece size must be at least 127 bytes, got 126")
+		require.Equal(t, cid.Undef, cids[3])
+	})
+}
+
+func TestDowngradeToV1PieceCIDs(t *testing.T) {
+	entries := []commcid.V1PieceEntry{
+		{CID: cid.MustParse(fixture32GiBEmptyV1), UnpaddedSize: fixture32GiBUnpadded},
+		{CID: cid.MustParse(fixture127OfEach0123PieceCID), UnpaddedSize: 500},
+	}
+	v2cids, err := commcid.UpgradeV1PieceCIDs(entries)
+	require.NoError(t, err)
+
+	cids, sizes, err := commcid.DowngradeToV1PieceCIDs(v2cids)
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{entries[0].CID, entries[1].CID}, cids)
+	require.Equal(t, []uint64{fixture32GiBUnpadded, 500}, sizes)
+
+	_, _, err = commcid.DowngradeToV1PieceCIDs(append(v2cids, entries[0].CID))
+	require.ErrorIs(t, err, commcid.ErrIncorrectHash)
+	require.Regexp(t, "^piece CID 2: ", err.Error())
+}
@@ -0,0 +1,38 @@
+package commcid
+
+import "github.com/ipfs/go-cid"
+
+// cbor major types used by the hand-rolled dag-cbor encoders
+const (
+	cborMajorBytes = 2
+	cborMajorArray = 4
+	cborMajorMap   = 5
+)
+
+// appendCborHeader appends the header of a cbor item of the given major type
+// and length to buf
+func appendCborHeader(buf []byte, major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return append(buf, major|byte(n))
+	case n < 1<<8:
+		return append(buf, major|24, byte(n))
+	case n < 1<<16:
+		return append(buf, major|25, byte(n>>8), byte(n))
+	case n < 1<<32:
+		return append(buf, major|26, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	default:
+		return append(buf, major|27, byte(n>>56), byte(n>>48), byte(n>>40), byte(n>>32), byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+// appendCborLink appends the dag-cbor encoding of a link to c: tag 42 wrapping
+// the CID bytes behind a zero multibase prefix
+func appendCborLink(buf []byte, c cid.Cid) []byte {
+	cidBytes := c.Bytes()
+	buf = append(buf, 0xd8, 0x2a)
+	buf = appendCborHeader(buf, cborMajorBytes, uint64(len(cidBytes))+1)
+	buf = append(buf, 0)
+	return append(buf, cidBytes...)
+}
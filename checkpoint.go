@@ -0,0 +1,148 @@
+package commcid
+
+import (
+	"encoding"
+	"io"
+	"math/bits"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-varint"
+	"golang.org/x/xerrors"
+)
+
+// pieceBuilderStateVersion prefixes serialized PieceBuilder state
+const pieceBuilderStateVersion = 1
+
+var (
+	_ encoding.BinaryMarshaler   = (*PieceBuilder)(nil)
+	_ encoding.BinaryUnmarshaler = (*PieceBuilder)(nil)
+)
+
+// MarshalBinary serializes the builder state so hashing can later resume from
+// the same point
+func (b *PieceBuilder) MarshalBinary() ([]byte, error) {
+	buf := []byte{pieceBuilderStateVersion}
+	buf = append(buf, varint.ToUvarint(b.leaves)...)
+	buf = append(buf, varint.ToUvarint(b.unpadded)...)
+	if b.closed {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+	for layer := 0; layer <= maxTreeHeight; layer++ {
+		if (b.leaves>>layer)&1 == 1 {
+			buf = append(buf, b.layers[layer][:]...)
+		}
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary restores builder state produced by MarshalBinary
+func (b *PieceBuilder) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || data[0] != pieceBuilderStateVersion {
+		return xerrors.New("unsupported piece builder state version")
+	}
+	data = data[1:]
+
+	leaves, n, err := varint.FromUvarint(data)
+	if err != nil {
+		return xerrors.Errorf("Error decoding piece builder state: %w", err)
+	}
+	data = data[n:]
+	unpadded, n, err := varint.FromUvarint(data)
+	if err != nil {
+		return xerrors.Errorf("Error decoding piece builder state: %w", err)
+	}
+	data = data[n:]
+
+	if leaves>>(maxTreeHeight+1) != 0 || len(data) != 1+bits.OnesCount64(leaves)*nodeSize || data[0] > 1 {
+		return xerrors.New("malformed piece builder state")
+	}
+	if err := validateBuilderCounts(leaves, unpadded, data[0] == 1); err != nil {
+		return err
+	}
+
+	*b = PieceBuilder{leaves: leaves, unpadded: unpadded, closed: data[0] == 1}
+	data = data[1:]
+	for layer := 0; layer <= maxTreeHeight; layer++ {
+		if (leaves>>layer)&1 == 1 {
+			copy(b.layers[layer][:], data)
+			data = data[nodeSize:]
+			// every leaf and node is a field element with its top bits clear
+			if b.layers[layer][nodeSize-1]&0xc0 != 0 {
+				*b = PieceBuilder{}
+				return xerrors.Errorf("piece builder state has an invalid node at layer %d", layer)
+			}
+		}
+	}
+	return nil
+}
+
+// validateBuilderCounts checks that a leaf count, unpadded byte count and
+// closed flag describe a state the builder can reach: every 127 byte chunk
+// adds four leaves, only the final chunk may be partial, and a partial chunk
+// closes the builder
+func validateBuilderCounts(leaves, unpadded uint64, closed bool) error {
+	const leavesPerChunk = fr32PaddedChunk / nodeSize
+	if leaves%leavesPerChunk != 0 {
+		return xerrors.Errorf("piece builder state has %d leaves, not a whole number of chunks", leaves)
+	}
+	chunks := leaves / leavesPerChunk
+	if unpadded > chunks*fr32UnpaddedChunk || (chunks > 0 && unpadded <= (chunks-1)*fr32UnpaddedChunk) {
+		return xerrors.Errorf("piece builder state has %d bytes, which do not fill %d chunks", unpadded, chunks)
+	}
+	if closed != (unpadded%fr32UnpaddedChunk != 0) {
+		return xerrors.New("piece builder state closed flag does not match its byte count")
+	}
+	return nil
+}
+
+// PieceCIDFromReaderWithCheckpoints computes the v1 piece CID and padded piece
+// size of all data read from r, calling checkpointFn after each block of data
+// with the serialized builder state and the number of bytes hashed so far. If
+// hashing is interrupted, ResumePieceCIDFromReader continues from the last
+// checkpoint. An error from checkpointFn aborts hashing.
+func PieceCIDFromReaderWithCheckpoints(r io.Reader, checkpointFn func(state []byte, bytesProcessed uint64) error) (cid.Cid, uint64, error) {
+	return pieceCIDWithCheckpoints(new(PieceBuilder), r, checkpointFn)
+}
+
+// ResumePieceCIDFromReader continues a hash started by
+// PieceCIDFromReaderWithCheckpoints from a checkpointed state; r must be
+// positioned just past the bytesProcessed reported with that state.
+// checkpointFn may be nil.
+func ResumePieceCIDFromReader(r io.Reader, state []byte, checkpointFn func(state []byte, bytesProcessed uint64) error) (cid.Cid, uint64, error) {
+	var b PieceBuilder
+	if err := b.UnmarshalBinary(state); err != nil {
+		return cid.Undef, 0, err
+	}
+	return pieceCIDWithCheckpoints(&b, r, checkpointFn)
+}
+
+func pieceCIDWithCheckpoints(b *PieceBuilder, r io.Reader, checkpointFn func(state []byte, bytesProcessed uint64) error) (cid.Cid, uint64, error) {
+	var afterChunk func() error
+	if checkpointFn != nil {
+		afterChunk = func() error {
+			state, err := b.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			if err := checkpointFn(state, b.unpadded); err != nil {
+				return xerrors.Errorf("checkpoint: %w", err)
+			}
+			return nil
+		}
+	}
+	if err := b.readFrom(r, make([]byte, readChunkSize), nil, afterChunk); err != nil {
+		return cid.Undef, 0, err
+	}
+
+	commP, _, paddedSize, err := b.Digest()
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	c, err := PieceCommitmentV1ToCID(commP)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	return c, paddedSize, nil
+}
@@ -0,0 +1,110 @@
+package commcid_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPieceCIDFromReaderWithCheckpoints(t *testing.T) {
+	data := bytes.Repeat(fixture127OfEach0123, 1500)
+	expected, expectedSize, err := commcid.PieceCIDFromReader(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	type checkpoint struct {
+		state          []byte
+		bytesProcessed uint64
+	}
+	var checkpoints []checkpoint
+	c, paddedSize, err := commcid.PieceCIDFromReaderWithCheckpoints(bytes.NewReader(data), func(state []byte, bytesProcessed uint64) error {
+		checkpoints = append(checkpoints, checkpoint{state, bytesProcessed})
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, expected, c)
+	require.Equal(t, expectedSize, paddedSize)
+	require.NotEmpty(t, checkpoints)
+
+	for _, cp := range checkpoints {
+		c, paddedSize, err := commcid.ResumePieceCIDFromReader(bytes.NewReader(data[cp.bytesProcessed:]), cp.state, nil)
+		require.NoError(t, err)
+		require.Equal(t, expected, c, "resuming at %d", cp.bytesProcessed)
+		require.Equal(t, expectedSize, paddedSize)
+	}
+
+	t.Run("checkpoint error aborts hashing", func(t *testing.T) {
+		errStop := errors.New("stop")
+		_, _, err := commcid.PieceCIDFromReaderWithCheckpoints(bytes.NewReader(data), func([]byte, uint64) error {
+			return errStop
+		})
+		require.ErrorIs(t, err, errStop)
+	})
+
+	t.Run("error on malformed state", func(t *testing.T) {
+		_, _, err := commcid.ResumePieceCIDFromReader(bytes.NewReader(data), checkpoints[0].state[:10], nil)
+		require.EqualError(t, err, "malformed piece builder state")
+	})
+}
+
+func TestPieceBuilderUnmarshalRejectsCorruptState(t *testing.T) {
+	var b commcid.PieceBuilder
+	require.NoError(t, b.AddData(fixture127OfEach0123[:254]))
+	state, err := b.MarshalBinary()
+	require.NoError(t, err)
+	// version, 8 leaves, 254 bytes, open, one node at layer 3
+	require.Equal(t, []byte{1, 8, 0xfe, 0x01, 0}, state[:5])
+	node := state[5:]
+	require.Len(t, node, 32)
+
+	var restored commcid.PieceBuilder
+	require.NoError(t, restored.UnmarshalBinary(state))
+
+	corrupt := func(header ...byte) []byte {
+		return append(header, node...)
+	}
+	for name, tc := range map[string]struct {
+		state []byte
+		err   string
+	}{
+		"more bytes than the leaves hold": {
+			corrupt(1, 8, 0xfd, 0x02, 0),
+			"piece builder state has 381 bytes, which do not fill 2 chunks",
+		},
+		"fewer bytes than the leaves need": {
+			corrupt(1, 8, 0x7f, 0),
+			"piece builder state has 127 bytes, which do not fill 2 chunks",
+		},
+		"bytes without leaves": {
+			[]byte{1, 0, 0x7f, 0},
+			"piece builder state has 127 bytes, which do not fill 0 chunks",
+		},
+		"leaves that split a chunk": {
+			append(corrupt(1, 0x09, 0xfe, 0x01, 0), node...),
+			"piece builder state has 9 leaves, not a whole number of chunks",
+		},
+		"closed after whole chunks": {
+			corrupt(1, 8, 0xfe, 0x01, 1),
+			"piece builder state closed flag does not match its byte count",
+		},
+		"open after a partial chunk": {
+			corrupt(1, 8, 0xfd, 0x01, 0),
+			"piece builder state closed flag does not match its byte count",
+		},
+		"unknown closed flag": {
+			corrupt(1, 8, 0xfe, 0x01, 2),
+			"malformed piece builder state",
+		},
+		"node outside the field": {
+			append([]byte{1, 8, 0xfe, 0x01, 0}, append(append([]byte{}, node[:31]...), node[31]|0x80)...),
+			"piece builder state has an invalid node at layer 3",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var b commcid.PieceBuilder
+			require.EqualError(t, b.UnmarshalBinary(tc.state), tc.err)
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package commcid
+
+import (
+	"io"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// ChunkingStrategy controls how much data the hasher reads and buffers before
+// feeding it to the tree builder. Larger reads cost more memory but fewer
+// calls into the reader; the resulting CID is the same for any strategy.
+type ChunkingStrategy interface {
+	// ReadSize returns the number of bytes to read per step, which must be a
+	// positive multiple of 127
+	ReadSize() int
+}
+
+type fixedChunking int
+
+func (f fixedChunking) ReadSize() int {
+	return int(f)
+}
+
+var (
+	// DefaultChunking reads 127KiB at a time, the size used by
+	// PieceCIDFromReader
+	DefaultChunking ChunkingStrategy = fixedChunking(readChunkSize)
+	// LowMemoryChunking reads a single 1016 byte run of eight FR32 chunks at a
+	// time
+	LowMemoryChunking ChunkingStrategy = fixedChunking(fr32UnpaddedChunk * 8)
+)
+
+// PieceCIDFromReaderWithStrategy computes the v1 piece CID and padded piece
+// size of all data read from r, reading as directed by s. A nil strategy uses
+// DefaultChunking.
+func PieceCIDFromReaderWithStrategy(r io.Reader, s ChunkingStrategy) (cid.Cid, uint64, error) {
+	if s == nil {
+		s = DefaultChunking
+	}
+	readSize := s.ReadSize()
+	if readSize <= 0 || readSize%fr32UnpaddedChunk != 0 {
+		return cid.Undef, 0, xerrors.Errorf("read size %d is not a positive multiple of %d", readSize, fr32UnpaddedChunk)
+	}
+
+	commP, _, paddedSize, err := dataCommitmentFromReader(r, readSize)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	c, err := PieceCommitmentV1ToCID(commP)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	return c, paddedSize, nil
+}
@@ -0,0 +1,37 @@
+package commcid_test
+
+import (
+	"bytes"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/stretchr/testify/require"
+)
+
+type testChunking int
+
+func (c testChunking) ReadSize() int {
+	return int(c)
+}
+
+func TestPieceCIDFromReaderWithStrategy(t *testing.T) {
+	data := bytes.Repeat(fixture127OfEach0123, 300)
+	expected, expectedSize, err := commcid.PieceCIDFromReader(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	for _, s := range []commcid.ChunkingStrategy{nil, commcid.DefaultChunking, commcid.LowMemoryChunking, testChunking(127)} {
+		c, paddedSize, err := commcid.PieceCIDFromReaderWithStrategy(bytes.NewReader(data), s)
+		require.NoError(t, err)
+		require.Equal(t, expected, c)
+		require.Equal(t, expectedSize, paddedSize)
+	}
+
+	c, _, err := commcid.PieceCIDFromReaderWithStrategy(bytes.NewReader(fixture127OfEach0123), commcid.LowMemoryChunking)
+	require.NoError(t, err)
+	require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+
+	t.Run("error on unaligned read size", func(t *testing.T) {
+		_, _, err := commcid.PieceCIDFromReaderWithStrategy(bytes.NewReader(data), testChunking(128))
+		require.EqualError(t, err, "read size 128 is not a positive multiple of 127")
+	})
+}
@@ -0,0 +1,254 @@
+package commcid
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/multiformats/go-varint"
+	"golang.org/x/xerrors"
+)
+
+// CommitmentType identifies which kind of Filecoin commitment a CID carries
+type CommitmentType int
+
+const (
+	// CommitmentTypeUnknown is returned for CIDs that are not a recognized
+	// Filecoin commitment
+	CommitmentTypeUnknown CommitmentType = iota
+	// CommitmentTypeData is an unsealed data (or piece) commitment
+	CommitmentTypeData
+	// CommitmentTypeReplica is a sealed replica commitment
+	CommitmentTypeReplica
+	// CommitmentTypePieceV2 is a v2 piece CID, carrying the piece size
+	// alongside the data commitment
+	CommitmentTypePieceV2
+)
+
+// Kind is the kind of commitment held by a CID or parsed commitment string. It
+// is another name for CommitmentType.
+type Kind = CommitmentType
+
+// The kinds of commitment, under the names used with Kind
+const (
+	KindUnknown           = CommitmentTypeUnknown
+	KindDataCommitment    = CommitmentTypeData
+	KindReplicaCommitment = CommitmentTypeReplica
+	KindPieceV2           = CommitmentTypePieceV2
+)
+
+// String returns a human readable name for the commitment type
+func (t CommitmentType) String() string {
+	switch t {
+	case CommitmentTypeData:
+		return "data commitment"
+	case CommitmentTypeReplica:
+		return "replica commitment"
+	case CommitmentTypePieceV2:
+		return "v2 piece commitment"
+	default:
+		return "unknown commitment"
+	}
+}
+
+// Classify reports which kind of commitment the given CID holds, returning
+// CommitmentTypeUnknown if the codec and hash do not form a valid commitment
+func Classify(c cid.Cid) CommitmentType {
+	if _, _, _, err := decodePieceMhCID(c); err == nil {
+		return CommitmentTypePieceV2
+	}
+
+	codec, _, _, err := CIDToCommitment(c)
+	if err != nil {
+		return CommitmentTypeUnknown
+	}
+	switch codec {
+	case cid.FilCommitmentUnsealed:
+		return CommitmentTypeData
+	case cid.FilCommitmentSealed:
+		return CommitmentTypeReplica
+	default:
+		return CommitmentTypeUnknown
+	}
+}
+
+// KindOf is Classify without any allocation: it reads the CID in place and
+// returns KindUnknown for malformed or non-commitment CIDs
+func KindOf(c cid.Cid) Kind {
+	switch {
+	case IsDataCommitmentCID(c):
+		return KindDataCommitment
+	case IsReplicaCommitmentCID(c):
+		return KindReplicaCommitment
+	}
+	if _, _, ok := parsePieceMhCIDHeader(c); ok {
+		return KindPieceV2
+	}
+	return KindUnknown
+}
+
+// IsDataCommitmentCID reports whether c has the codec and multihash of a data
+// (v1 piece) commitment. It decodes only the CID header and never errors.
+func IsDataCommitmentCID(c cid.Cid) bool {
+	codec, hashCode, digestLen, ok := commitmentHeader(c)
+	return ok && codec == cid.FilCommitmentUnsealed && hashCode == multihash.SHA2_256_TRUNC254_PADDED && digestLen == nodeSize
+}
+
+// IsReplicaCommitmentCID reports whether c has the codec and multihash of a
+// replica commitment. It decodes only the CID header and never errors.
+func IsReplicaCommitmentCID(c cid.Cid) bool {
+	codec, hashCode, digestLen, ok := commitmentHeader(c)
+	return ok && codec == cid.FilCommitmentSealed && hashCode == multihash.POSEIDON_BLS12_381_A1_FC1 && digestLen == nodeSize
+}
+
+// IsPieceCIDV2 reports whether c has the codec and multihash of a v2 piece
+// CID, with a digest long enough for the padding, tree height and commitment.
+// It decodes only the CID header and never errors; the padding and height are
+// not range checked.
+func IsPieceCIDV2(c cid.Cid) bool {
+	codec, hashCode, digestLen, ok := commitmentHeader(c)
+	return ok && codec == cid.Raw && hashCode == FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE &&
+		digestLen >= 1+1+nodeSize && digestLen <= varint.MaxLenUvarint63+1+nodeSize
+}
+
+// commitmentHeader decodes the codec, multihash code and digest length of a
+// CIDv1 straight from its binary form, without copying it
+func commitmentHeader(c cid.Cid) (codec, hashCode uint64, digestLen int, ok bool) {
+	s := c.KeyString()
+	var fields [4]uint64
+	for i := range fields {
+		var n int
+		fields[i], n = uvarintFromString(s)
+		if n == 0 {
+			return 0, 0, 0, false
+		}
+		s = s[n:]
+	}
+	if fields[0] != 1 || fields[3] != uint64(len(s)) {
+		return 0, 0, 0, false
+	}
+	return fields[1], fields[2], len(s), true
+}
+
+// uvarintFromString decodes a uvarint from the start of s, returning the
+// number of bytes read or 0 if s does not start with one
+func uvarintFromString(s string) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(s) && i < varint.MaxLenUvarint63; i++ {
+		b := s[i]
+		v |= uint64(b&0x7f) << (7 * i)
+		if b < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// RequireType returns an error wrapping ErrIncorrectCodec unless the CID is a
+// commitment of the expected type
+func RequireType(c cid.Cid, t CommitmentType) error {
+	if actual := Classify(c); actual != t {
+		return xerrors.Errorf("expected %s, got %s: %w", t, actual, ErrIncorrectCodec)
+	}
+	return nil
+}
+
+// Describe returns a one line summary of a commitment CID: its kind and
+// commitment in hex, followed for v2 piece CIDs by the tree height, padding
+// and unpadded and padded sizes, e.g.
+//
+//	v2 piece commitment 077e5fde35c50a9303a55009e3498a4ebedff39c42b710b730d8ec7ac7afa63e height=30 padding=0 unpadded=34091302912 padded=34359738368
+//
+// It returns ErrIncorrectCodec for CIDs that are not commitments.
+func Describe(c cid.Cid) (string, error) {
+	t := Classify(c)
+	if t == CommitmentTypeUnknown {
+		return "", ErrIncorrectCodec
+	}
+	commX, err := commitmentDigest(c)
+	if err != nil {
+		return "", err
+	}
+	desc := t.String() + " " + hex.EncodeToString(commX)
+	if t != CommitmentTypePieceV2 {
+		return desc, nil
+	}
+
+	p, err := NewPieceCIDV2(c)
+	if err != nil {
+		return "", err
+	}
+	return desc + fmt.Sprintf(" height=%d padding=%d unpadded=%d padded=%d", p.TreeHeight(), p.PaddingSize(), p.UnpaddedSize(), p.PaddedSize()), nil
+}
+
+// commitmentDigest extracts the raw commitment from a data, replica or v2
+// piece CID
+func commitmentDigest(c cid.Cid) ([]byte, error) {
+	if Classify(c) == CommitmentTypePieceV2 {
+		commX, _, err := PieceMhCIDToDataCommitmentV1(c)
+		return commX, err
+	}
+	_, _, commX, err := CIDToCommitment(c)
+	return commX, err
+}
+
+// CommitmentKey packs the kind, v2 piece size and raw commitment of a data,
+// replica or v2 piece CID into a fixed-size array usable as a comparable map
+// key, without allocating. Byte 0 holds the kind, with v2 piece CIDs folded
+// into data commitments, and the last 32 bytes hold the commitment. For a v2
+// piece CID byte 1 holds the tree height and bytes 2 to 7 the big-endian
+// padding; for v1 CIDs, which carry no size, they are zero.
+//
+// Pieces that share a root can still differ in size, so v1 and v2 CIDs of the
+// same piece only share a key once the size is dropped: clearing bytes 1 to 7
+// of a v2 key gives the key of the matching v1 CID. A v2 piece CID with 2^48
+// or more bytes of padding has no key.
+func CommitmentKey(c cid.Cid) ([40]byte, error) {
+	key, padding, err := commitmentKeyAndPadding(c)
+	if err != nil {
+		return key, err
+	}
+	if padding[0]|padding[1] != 0 {
+		return key, xerrors.Errorf("padding %d of piece CID %s is too large for a commitment key", binary.BigEndian.Uint64(padding[:]), c)
+	}
+	copy(key[2:8], padding[2:])
+	return key, nil
+}
+
+// commitmentKeyAndPadding is CommitmentKey with bytes 2 to 7 left zero and the
+// full v2 padding returned big-endian alongside, so that no size is too large
+func commitmentKeyAndPadding(c cid.Cid) ([40]byte, [8]byte, error) {
+	var key [40]byte
+	var padding [8]byte
+
+	t := KindOf(c)
+	switch t {
+	case KindUnknown:
+		// surface why the CID is not a commitment
+		_, _, _, err := CIDToCommitment(c)
+		if err == nil {
+			err = ErrIncorrectCodec
+		}
+		return key, padding, err
+	case KindPieceV2:
+		height, p, _ := parsePieceMhCIDHeader(c)
+		key[1] = height
+		binary.BigEndian.PutUint64(padding[:], p)
+		t = KindDataCommitment
+	}
+
+	// every kind ends its digest, and so the CID, with the commitment
+	s := c.KeyString()
+	key[0] = byte(t)
+	copy(key[8:], s[len(s)-nodeSize:])
+	return key, padding, nil
+}
+
+// foldCommitmentKey drops the v2 piece size from a CommitmentKey, so that v1
+// and v2 CIDs of the same root share the result
+func foldCommitmentKey(key [40]byte) [40]byte {
+	clear(key[1:8])
+	return key
+}
@@ -0,0 +1,222 @@
+package commcid_test
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassify(t *testing.T) {
+	randBytes := make([]byte, 32)
+	_, err := rand.Read(randBytes)
+	require.NoError(t, err)
+	randBytes[31] &= 0x3f
+
+	dataCid, err := commcid.DataCommitmentV1ToCID(randBytes)
+	require.NoError(t, err)
+	require.Equal(t, commcid.CommitmentTypeData, commcid.Classify(dataCid))
+
+	replicaCid, err := commcid.ReplicaCommitmentV1ToCID(randBytes)
+	require.NoError(t, err)
+	require.Equal(t, commcid.CommitmentTypeReplica, commcid.Classify(replicaCid))
+
+	pieceCid, err := commcid.DataCommitmentV1ToPieceMhCID(randBytes, 127)
+	require.NoError(t, err)
+	require.Equal(t, commcid.CommitmentTypePieceV2, commcid.Classify(pieceCid))
+
+	other := cid.NewCidV1(cid.DagCBOR, testMultiHash(multihash.SHA2_256_TRUNC254_PADDED, randBytes, 0))
+	require.Equal(t, commcid.CommitmentTypeUnknown, commcid.Classify(other))
+}
+
+func TestRequireType(t *testing.T) {
+	randBytes := make([]byte, 32)
+	_, err := rand.Read(randBytes)
+	require.NoError(t, err)
+	randBytes[31] &= 0x3f
+
+	dataCid, err := commcid.DataCommitmentV1ToCID(randBytes)
+	require.NoError(t, err)
+	require.NoError(t, commcid.RequireType(dataCid, commcid.CommitmentTypeData))
+
+	replicaCid, err := commcid.ReplicaCommitmentV1ToCID(randBytes)
+	require.NoError(t, err)
+	err = commcid.RequireType(replicaCid, commcid.CommitmentTypeData)
+	require.EqualError(t, err, "expected data commitment, got replica commitment: unexpected commitment codec")
+	require.True(t, errors.Is(err, commcid.ErrIncorrectCodec))
+}
+
+func TestCommitmentKey(t *testing.T) {
+	v1Key, err := commcid.CommitmentKey(cid.MustParse(fixture32GiBEmptyV1))
+	require.NoError(t, err)
+	v2Key, err := commcid.CommitmentKey(cid.MustParse(fixture32GiBEmptyV2))
+	require.NoError(t, err)
+	require.NotEqual(t, v1Key, v2Key)
+	// a 32GiB tree has height 30 and no padding
+	require.Equal(t, [8]byte{byte(commcid.KindDataCommitment), 30}, [8]byte(v2Key[:8]))
+	folded := v2Key
+	clear(folded[1:8])
+	require.Equal(t, v1Key, folded)
+
+	commD, err := commcid.CIDToDataCommitmentV1(cid.MustParse(fixture32GiBEmptyV1))
+	require.NoError(t, err)
+	replicaCid, err := commcid.ReplicaCommitmentV1ToCID(commD)
+	require.NoError(t, err)
+	replicaKey, err := commcid.CommitmentKey(replicaCid)
+	require.NoError(t, err)
+	require.NotEqual(t, v1Key, replicaKey)
+
+	keys := map[[40]byte]struct{}{v1Key: {}, replicaKey: {}}
+	require.Len(t, keys, 2)
+
+	require.Equal(t, [8]byte{byte(commcid.KindDataCommitment)}, [8]byte(v1Key[:8]))
+	require.Equal(t, commD, v1Key[8:])
+
+	_, err = commcid.CommitmentKey(cid.NewCidV1(cid.DagCBOR, testMultiHash(multihash.SHA2_256_TRUNC254_PADDED, commD, 0)))
+	require.EqualError(t, err, commcid.ErrIncorrectCodec.Error())
+
+	t.Run("v2 piece CIDs of different sizes sharing a root", func(t *testing.T) {
+		plus4, plus5 := cid.MustParse(fixture127Plus4ZerosPieceCID), cid.MustParse(fixture127Plus5ZerosPieceCID)
+		plus4Key, err := commcid.CommitmentKey(plus4)
+		require.NoError(t, err)
+		plus5Key, err := commcid.CommitmentKey(plus5)
+		require.NoError(t, err)
+		require.NotEqual(t, plus4Key, plus5Key)
+		require.Equal(t, plus4Key[8:], plus5Key[8:])
+		// 131 and 132 bytes in a 256 byte tree, of height 3
+		require.Equal(t, [8]byte{byte(commcid.KindDataCommitment), 3, 0, 0, 0, 0, 0, 123}, [8]byte(plus4Key[:8]))
+		require.Equal(t, [8]byte{byte(commcid.KindDataCommitment), 3, 0, 0, 0, 0, 0, 122}, [8]byte(plus5Key[:8]))
+
+		commD := testRandomCommitments(t, 1)[0]
+		of127, err := commcid.DataCommitmentV1ToPieceMhCID(commD, 127)
+		require.NoError(t, err)
+		of128, err := commcid.DataCommitmentV1ToPieceMhCID(commD, 128)
+		require.NoError(t, err)
+		key127, err := commcid.CommitmentKey(of127)
+		require.NoError(t, err)
+		key128, err := commcid.CommitmentKey(of128)
+		require.NoError(t, err)
+		require.NotEqual(t, key127, key128)
+	})
+
+	t.Run("error on padding too large for the key", func(t *testing.T) {
+		// 2^50 bytes in a tree of height 46 leave 63*2^44 bytes of padding
+		huge, err := commcid.DataCommitmentV1ToPieceMhCID(commD, 1<<50)
+		require.NoError(t, err)
+		_, err = commcid.CommitmentKey(huge)
+		require.EqualError(t, err, "padding 1108307720798208 of piece CID "+huge.String()+" is too large for a commitment key")
+	})
+
+	t.Run("does not allocate", func(t *testing.T) {
+		v1Cid := cid.MustParse(fixture32GiBEmptyV1)
+		v2Cid := cid.MustParse(fixture32GiBEmptyV2)
+		allocs := testing.AllocsPerRun(100, func() {
+			_, _ = commcid.CommitmentKey(v1Cid)
+			_, _ = commcid.CommitmentKey(v2Cid)
+			_, _ = commcid.CommitmentKey(replicaCid)
+		})
+		require.Zero(t, allocs)
+	})
+}
+
+func TestCommitmentPredicates(t *testing.T) {
+	randBytes := make([]byte, 32)
+	_, err := rand.Read(randBytes)
+	require.NoError(t, err)
+	randBytes[31] &= 0x3f
+
+	dataCid := cid.MustParse(fixture32GiBEmptyV1)
+	pieceV2Cid := cid.MustParse(fixture32GiBEmptyV2)
+	replicaCid, err := commcid.ReplicaCommitmentV1ToCID(randBytes)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name                       string
+		c                          cid.Cid
+		isData, isReplica, isPiece bool
+	}{
+		{"data", dataCid, true, false, false},
+		{"replica", replicaCid, false, true, false},
+		{"v2 piece", pieceV2Cid, false, false, true},
+		{"raw identity", cid.MustParse("bafkqaaa"), false, false, false},
+		{"hash/codec mismatch", cid.NewCidV1(cid.FilCommitmentUnsealed, testMultiHash(multihash.POSEIDON_BLS12_381_A1_FC1, randBytes, 0)), false, false, false},
+		{"short digest", cid.NewCidV1(cid.FilCommitmentUnsealed, testMultiHash(multihash.SHA2_256_TRUNC254_PADDED, randBytes[:31], 0)), false, false, false},
+		{"v0", cid.MustParse("QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"), false, false, false},
+		{"undefined", cid.Undef, false, false, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.isData, commcid.IsDataCommitmentCID(tc.c))
+			require.Equal(t, tc.isReplica, commcid.IsReplicaCommitmentCID(tc.c))
+			require.Equal(t, tc.isPiece, commcid.IsPieceCIDV2(tc.c))
+		})
+	}
+
+	t.Run("does not allocate", func(t *testing.T) {
+		allocs := testing.AllocsPerRun(100, func() {
+			commcid.IsDataCommitmentCID(dataCid)
+			commcid.IsReplicaCommitmentCID(replicaCid)
+			commcid.IsPieceCIDV2(pieceV2Cid)
+		})
+		require.Zero(t, allocs)
+	})
+}
+
+func TestDescribe(t *testing.T) {
+	desc, err := commcid.Describe(cid.MustParse(fixture32GiBEmptyV1))
+	require.NoError(t, err)
+	require.Equal(t, "data commitment "+fixture32GiBEmptyHex, desc)
+
+	desc, err = commcid.Describe(cid.MustParse(fixture32GiBEmptyV2))
+	require.NoError(t, err)
+	require.Equal(t, "v2 piece commitment "+fixture32GiBEmptyHex+" height=30 padding=0 unpadded=34091302912 padded=34359738368", desc)
+
+	commR := make([]byte, 32)
+	commR[0] = 0xab
+	replicaCid, err := commcid.ReplicaCommitmentV1ToCID(commR)
+	require.NoError(t, err)
+	desc, err = commcid.Describe(replicaCid)
+	require.NoError(t, err)
+	require.Equal(t, "replica commitment ab00000000000000000000000000000000000000000000000000000000000000", desc)
+
+	v2, err := commcid.ConvertDataCommitmentV1V1CIDtoPieceMhCID(cid.MustParse(fixture127OfEach0123PieceCID), 500)
+	require.NoError(t, err)
+	desc, err = commcid.Describe(v2)
+	require.NoError(t, err)
+	require.Regexp(t, "^v2 piece commitment [0-9a-f]{64} height=4 padding=8 unpadded=500 padded=512$", desc)
+
+	t.Run("error on non-commitment CID", func(t *testing.T) {
+		encoded, err := multihash.Encode(commR, multihash.SHA2_256)
+		require.NoError(t, err)
+		_, err = commcid.Describe(cid.NewCidV1(cid.DagCBOR, encoded))
+		require.ErrorIs(t, err, commcid.ErrIncorrectCodec)
+	})
+}
+
+func TestKindOf(t *testing.T) {
+	commX := testRandomCommitments(t, 1)[0]
+	dataCid, err := commcid.DataCommitmentV1ToCID(commX)
+	require.NoError(t, err)
+	replicaCid, err := commcid.ReplicaCommitmentV1ToCID(commX)
+	require.NoError(t, err)
+	require.Equal(t, commcid.KindDataCommitment, commcid.KindOf(dataCid))
+	require.Equal(t, commcid.KindReplicaCommitment, commcid.KindOf(replicaCid))
+	require.Equal(t, commcid.KindPieceV2, commcid.KindOf(cid.MustParse(fixture32GiBEmptyV2)))
+	require.Equal(t, commcid.KindUnknown, commcid.KindOf(cid.Undef))
+	require.Equal(t, "v2 piece commitment", commcid.KindPieceV2.String())
+
+	// agrees with Classify, including on malformed v2 piece CIDs
+	for _, c := range append(testPieceMhCIDVectors(t, commX), dataCid, replicaCid) {
+		require.Equal(t, commcid.Classify(c), commcid.KindOf(c), "CID %s", c)
+	}
+
+	t.Run("does not allocate", func(t *testing.T) {
+		for _, c := range append(testPieceMhCIDVectors(t, commX), dataCid, replicaCid) {
+			require.Zero(t, testing.AllocsPerRun(10, func() { commcid.KindOf(c) }), "CID %s", c)
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package commcid
+
+import (
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+// SupportedCodecs returns the CID codecs used by the commitments this package
+// understands
+func SupportedCodecs() []uint64 {
+	return []uint64{
+		cid.FilCommitmentUnsealed,
+		cid.FilCommitmentSealed,
+		cid.Raw,
+	}
+}
+
+// SupportedMultihashCodes returns the multihash codes used by the commitments
+// this package understands
+func SupportedMultihashCodes() []uint64 {
+	return []uint64{
+		multihash.SHA2_256_TRUNC254_PADDED,
+		multihash.POSEIDON_BLS12_381_A1_FC1,
+		FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE,
+	}
+}
+
+// fr32MultihashName is the multicodec table name of
+// FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE
+const fr32MultihashName = "fr32-sha256-trunc254-padbintree"
+
+// go-multihash does not yet know the v2 piece CID multihash, so add it to its
+// code tables for tooling that prints algorithm names. An entry shipped by
+// go-multihash itself is left untouched.
+func init() {
+	if _, ok := multihash.Codes[FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE]; !ok {
+		multihash.Codes[FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE] = fr32MultihashName
+	}
+	if _, ok := multihash.Names[fr32MultihashName]; !ok {
+		multihash.Names[fr32MultihashName] = FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE
+	}
+}
@@ -0,0 +1,31 @@
+package commcid_test
+
+import (
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupportedCodecs(t *testing.T) {
+	require.ElementsMatch(t, []uint64{cid.FilCommitmentUnsealed, cid.FilCommitmentSealed, cid.Raw}, commcid.SupportedCodecs())
+}
+
+func TestSupportedMultihashCodes(t *testing.T) {
+	require.ElementsMatch(t, []uint64{
+		multihash.SHA2_256_TRUNC254_PADDED,
+		multihash.POSEIDON_BLS12_381_A1_FC1,
+		commcid.FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE,
+	}, commcid.SupportedMultihashCodes())
+}
+
+func TestFR32MultihashRegistered(t *testing.T) {
+	require.Equal(t, "fr32-sha256-trunc254-padbintree", multihash.Codes[commcid.FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE])
+	require.Equal(t, uint64(commcid.FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE), multihash.Names["fr32-sha256-trunc254-padbintree"])
+
+	decoded, err := multihash.Decode(cid.MustParse(fixture32GiBEmptyV2).Hash())
+	require.NoError(t, err)
+	require.Equal(t, "fr32-sha256-trunc254-padbintree", decoded.Name)
+}
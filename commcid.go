@@ -31,8 +31,51 @@ var (
 	// ErrIncorrectHash means the hash function for this CID does not match the expected
 	// hash for this type of commitment
 	ErrIncorrectHash = errors.New("incorrect hashing function for data commitment")
+	// ErrPieceTooLarge means more data was supplied than the caller allowed for
+	// a single piece
+	ErrPieceTooLarge = errors.New("piece data exceeds size limit")
+	// ErrInvalidTruncatedDigest means a SHA2_256_TRUNC254_PADDED digest has
+	// either of its two most significant bits set, which no Filecoin
+	// implementation produces
+	ErrInvalidTruncatedDigest = errors.New("truncated digest has its two most significant bits set")
+	// ErrInvalidFieldElement means a POSEIDON_BLS12_381_A1_FC1 digest is not a
+	// canonical element of the BLS12-381 scalar field
+	ErrInvalidFieldElement = errors.New("replica commitment is not below the BLS12-381 scalar field modulus")
+	// ErrSizeMismatch means the amount of data read differs from the size the
+	// caller declared for it
+	ErrSizeMismatch = errors.New("piece data size does not match declared size")
+	// ErrSizeOverflow means a total size does not fit in a uint64
+	ErrSizeOverflow = errors.New("size overflows uint64")
+	// ErrIncorrectLength means a raw commitment is not 32 bytes long
+	ErrIncorrectLength = errors.New("commitments must be 32 bytes long")
+	// ErrInvalidPieceDigest means a v2 piece CID digest is not a padding
+	// varint, a tree height byte and a 32 byte commitment
+	ErrInvalidPieceDigest = errors.New("piece multihash digest must hold padding, tree height and a 32 byte commitment")
+	// ErrInvalidTreeHeight means a v2 piece CID encodes a tree height outside
+	// the range a piece can have
+	ErrInvalidTreeHeight = errors.New("tree height out of range")
+	// ErrPaddingExceedsCapacity means a v2 piece CID encodes at least as much
+	// padding as its tree can hold, leaving no room for data
+	ErrPaddingExceedsCapacity = errors.New("padding exceeds tree capacity")
 )
 
+// DecodeError is returned when the multihash or digest fields of a commitment
+// CID cannot be decoded. It records the CID and the stage of decoding that
+// failed, and unwraps to the underlying multihash or varint error.
+type DecodeError struct {
+	CID   cid.Cid
+	Stage string
+	Err   error
+}
+
+func (e *DecodeError) Error() string {
+	return "Error decoding " + e.Stage + ": " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
 // CommitmentToCID converts a raw commitment hash to a CID
 // by adding:
 // - the given filecoin codec type
@@ -42,6 +85,12 @@ func CommitmentToCID(mc FilMultiCodec, mh FilMultiHash, commX []byte) (cid.Cid,
 		return cid.Undef, err
 	}
 
+	return cid.NewCidV1(uint64(mc), commitmentMultihash(mh, commX)), nil
+}
+
+// commitmentMultihash encodes a raw commitment as a multihash of the given
+// type, without validating either
+func commitmentMultihash(mh FilMultiHash, commX []byte) multihash.Multihash {
 	mhBuf := make(
 		[]byte,
 		(varint.UvarintSize(uint64(mh)) + varint.UvarintSize(uint64(len(commX))) + len(commX)),
@@ -51,7 +100,7 @@ func CommitmentToCID(mc FilMultiCodec, mh FilMultiHash, commX []byte) (cid.Cid,
 	pos += varint.PutUvarint(mhBuf[pos:], uint64(len(commX)))
 	copy(mhBuf[pos:], commX)
 
-	return cid.NewCidV1(uint64(mc), multihash.Multihash(mhBuf)), nil
+	return multihash.Multihash(mhBuf)
 }
 
 // CIDToCommitment extracts the raw commitment bytes, the FilMultiCodec and
@@ -60,7 +109,7 @@ func CommitmentToCID(mc FilMultiCodec, mh FilMultiHash, commX []byte) (cid.Cid,
 func CIDToCommitment(c cid.Cid) (FilMultiCodec, FilMultiHash, []byte, error) {
 	decoded, err := multihash.Decode([]byte(c.Hash()))
 	if err != nil {
-		return FILCODEC_UNDEFINED, FILMULTIHASH_UNDEFINED, nil, xerrors.Errorf("Error decoding data commitment hash: %w", err)
+		return FILCODEC_UNDEFINED, FILMULTIHASH_UNDEFINED, nil, &DecodeError{CID: c, Stage: "data commitment hash", Err: err}
 	}
 
 	filCodec := FilMultiCodec(c.Type())
@@ -76,10 +125,31 @@ func CIDToCommitment(c cid.Cid) (FilMultiCodec, FilMultiHash, []byte, error) {
 // by adding:
 // - codec: cid.FilCommitmentUnsealed
 // - hash type: multihash.SHA2_256_TRUNC254_PADDED
+// It returns ErrInvalidTruncatedDigest if the top two bits of the commitment
+// are set.
 func DataCommitmentV1ToCID(commD []byte) (cid.Cid, error) {
+	if err := validateTruncatedDigest(commD); err != nil {
+		return cid.Undef, err
+	}
+	return DataCommitmentV1ToCIDUnchecked(commD)
+}
+
+// DataCommitmentV1ToCIDUnchecked is DataCommitmentV1ToCID without the check
+// that the commitment is a valid truncated digest
+func DataCommitmentV1ToCIDUnchecked(commD []byte) (cid.Cid, error) {
 	return CommitmentToCID(cid.FilCommitmentUnsealed, multihash.SHA2_256_TRUNC254_PADDED, commD)
 }
 
+// validateTruncatedDigest returns ErrInvalidTruncatedDigest if a 32 byte
+// SHA2_256_TRUNC254_PADDED digest has either of its top two bits set; other
+// lengths are left for the segment validation to reject
+func validateTruncatedDigest(digest []byte) error {
+	if len(digest) == nodeSize && digest[nodeSize-1]&0xc0 != 0 {
+		return ErrInvalidTruncatedDigest
+	}
+	return nil
+}
+
 // CIDToDataCommitmentV1 extracts the raw data commitment from a CID
 // after checking for the correct codec and hash types.
 func CIDToDataCommitmentV1(c cid.Cid) ([]byte, error) {
@@ -93,14 +163,72 @@ func CIDToDataCommitmentV1(c cid.Cid) ([]byte, error) {
 	return commD, nil
 }
 
+// CIDToDataCommitmentV1Into is CIDToDataCommitmentV1 writing the commitment
+// into dst, which must be 32 bytes long, instead of allocating. A valid data
+// commitment CID is decoded without any allocation.
+func CIDToDataCommitmentV1Into(dst []byte, c cid.Cid) error {
+	if len(dst) != nodeSize {
+		return xerrors.Errorf("destination must be %d bytes long, got %d", nodeSize, len(dst))
+	}
+	if IsDataCommitmentCID(c) {
+		s := c.KeyString()
+		copy(dst, s[len(s)-nodeSize:])
+		return nil
+	}
+	// not a data commitment, so decode it the slow way for the error
+	commD, err := CIDToDataCommitmentV1(c)
+	if err != nil {
+		return err
+	}
+	copy(dst, commD)
+	return nil
+}
+
 // ReplicaCommitmentV1ToCID converts a raw data commitment to a CID
 // by adding:
 // - codec: cid.FilCommitmentSealed
 // - hash type: multihash.POSEIDON_BLS12_381_A1_FC1
+// It returns ErrInvalidFieldElement if the commitment, read as a little-endian
+// integer, is not below the BLS12-381 scalar field modulus.
 func ReplicaCommitmentV1ToCID(commR []byte) (cid.Cid, error) {
+	if err := validateFieldElement(commR); err != nil {
+		return cid.Undef, err
+	}
+	return ReplicaCommitmentV1ToCIDUnchecked(commR)
+}
+
+// ReplicaCommitmentV1ToCIDUnchecked is ReplicaCommitmentV1ToCID without the
+// check that the commitment is a canonical field element
+func ReplicaCommitmentV1ToCIDUnchecked(commR []byte) (cid.Cid, error) {
 	return CommitmentToCID(cid.FilCommitmentSealed, multihash.POSEIDON_BLS12_381_A1_FC1, commR)
 }
 
+// bls12381ScalarModulus is the order of the BLS12-381 scalar field in
+// little-endian byte order
+var bls12381ScalarModulus = [32]byte{
+	0x01, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff, 0xfe, 0x5b, 0xfe, 0xff, 0x02, 0xa4, 0xbd, 0x53,
+	0x05, 0xd8, 0xa1, 0x09, 0x08, 0xd8, 0x39, 0x33, 0x48, 0x7d, 0x9d, 0x29, 0x53, 0xa7, 0xed, 0x73,
+}
+
+// validateFieldElement returns ErrInvalidFieldElement if a 32 byte
+// little-endian POSEIDON_BLS12_381_A1_FC1 digest is not below the scalar field
+// modulus; other lengths are left for the segment validation to reject
+func validateFieldElement(digest []byte) error {
+	if len(digest) != nodeSize {
+		return nil
+	}
+	for i := nodeSize - 1; i >= 0; i-- {
+		switch {
+		case digest[i] < bls12381ScalarModulus[i]:
+			return nil
+		case digest[i] > bls12381ScalarModulus[i]:
+			return ErrInvalidFieldElement
+		}
+	}
+	// equal to the modulus
+	return ErrInvalidFieldElement
+}
+
 // CIDToReplicaCommitmentV1 extracts the raw replica commitment from a CID
 // after checking for the correct codec and hash types.
 func CIDToReplicaCommitmentV1(c cid.Cid) ([]byte, error) {
@@ -131,10 +259,15 @@ func validateFilecoinCidSegments(mc FilMultiCodec, mh FilMultiHash, commX []byte
 		return ErrIncorrectCodec
 	}
 
-	if len(commX) != 32 {
-		return fmt.Errorf("commitments must be 32 bytes long")
-	}
+	return validateCommitmentLength(commX)
+}
 
+// validateCommitmentLength returns ErrIncorrectLength, wrapped with the actual
+// length, unless commX is 32 bytes long
+func validateCommitmentLength(commX []byte) error {
+	if len(commX) != nodeSize {
+		return fmt.Errorf("%w, got %d", ErrIncorrectLength, len(commX))
+	}
 	return nil
 }
 
@@ -143,6 +276,12 @@ func validateFilecoinCidSegments(mc FilMultiCodec, mh FilMultiHash, commX []byte
 // DataCommitmentV1ToCID.
 var PieceCommitmentV1ToCID = DataCommitmentV1ToCID
 
+// PieceCommitmentV1ToCIDUnchecked converts a commP to a CID without checking it
+// is a valid truncated digest
+// -- it is just a helper function that is equivalent to
+// DataCommitmentV1ToCIDUnchecked.
+var PieceCommitmentV1ToCIDUnchecked = DataCommitmentV1ToCIDUnchecked
+
 // CIDToPieceCommitmentV1 converts a CID to a commP
 // -- it is just a helper function that is equivalent to
 // CIDToDataCommitmentV1.
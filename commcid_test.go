@@ -3,6 +3,9 @@ package commcid_test
 import (
 	"bytes"
 	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"testing"
 
 	commcid "github.com/filecoin-project/go-fil-commcid"
@@ -16,6 +19,7 @@ func TestDataCommitmentToCID(t *testing.T) {
 	randBytes := make([]byte, 32)
 	_, err := rand.Read(randBytes)
 	require.NoError(t, err)
+	randBytes[31] &= 0x3f
 
 	c, err := commcid.DataCommitmentV1ToCID(randBytes)
 	require.NoError(t, err)
@@ -27,6 +31,25 @@ func TestDataCommitmentToCID(t *testing.T) {
 	require.Equal(t, decoded.Code, uint64(multihash.SHA2_256_TRUNC254_PADDED))
 	require.Equal(t, decoded.Length, len(randBytes))
 	require.True(t, bytes.Equal(decoded.Digest, randBytes))
+
+	t.Run("error on top bits set", func(t *testing.T) {
+		invalid := bytes.Clone(randBytes)
+		invalid[31] |= 0x40
+		_, err := commcid.DataCommitmentV1ToCID(invalid)
+		require.ErrorIs(t, err, commcid.ErrInvalidTruncatedDigest)
+		_, err = commcid.PieceCommitmentV1ToCID(invalid)
+		require.ErrorIs(t, err, commcid.ErrInvalidTruncatedDigest)
+
+		c, err := commcid.DataCommitmentV1ToCIDUnchecked(invalid)
+		require.NoError(t, err)
+		decoded, err := commcid.CIDToDataCommitmentV1(c)
+		require.NoError(t, err)
+		require.Equal(t, invalid, decoded)
+
+		unchecked, err := commcid.PieceCommitmentV1ToCIDUnchecked(invalid)
+		require.NoError(t, err)
+		require.Equal(t, c, unchecked)
+	})
 }
 
 func TestCIDToDataCommitment(t *testing.T) {
@@ -81,6 +104,7 @@ func TestReplicaCommitmentToCID(t *testing.T) {
 	randBytes := make([]byte, 32)
 	_, err := rand.Read(randBytes)
 	require.NoError(t, err)
+	randBytes[31] &= 0x3f
 
 	c, err := commcid.ReplicaCommitmentV1ToCID(randBytes)
 	require.NoError(t, err)
@@ -92,6 +116,34 @@ func TestReplicaCommitmentToCID(t *testing.T) {
 	require.Equal(t, decoded.Code, uint64(multihash.POSEIDON_BLS12_381_A1_FC1))
 	require.Equal(t, decoded.Length, len(randBytes))
 	require.True(t, bytes.Equal(decoded.Digest, randBytes))
+
+	t.Run("field element range at the modulus boundary", func(t *testing.T) {
+		// the BLS12-381 scalar field modulus, little-endian
+		modulus, err := hex.DecodeString("01000000fffffffffe5bfeff02a4bd5305d8a10908d83933487d9d2953a7ed73")
+		require.NoError(t, err)
+
+		belowModulus := bytes.Clone(modulus)
+		belowModulus[0]--
+		_, err = commcid.ReplicaCommitmentV1ToCID(belowModulus)
+		require.NoError(t, err)
+
+		aboveModulus := bytes.Clone(modulus)
+		aboveModulus[0]++
+		highBytes := bytes.Repeat([]byte{0xff}, 32)
+		for _, invalid := range [][]byte{modulus, aboveModulus, highBytes} {
+			_, err := commcid.ReplicaCommitmentV1ToCID(invalid)
+			require.ErrorIs(t, err, commcid.ErrInvalidFieldElement)
+
+			c, err := commcid.ReplicaCommitmentV1ToCIDUnchecked(invalid)
+			require.NoError(t, err)
+			decoded, err := commcid.CIDToReplicaCommitmentV1(c)
+			require.NoError(t, err)
+			require.Equal(t, invalid, decoded)
+		}
+
+		_, err = commcid.ReplicaCommitmentsV1ToCIDs([][]byte{belowModulus, modulus})
+		require.EqualError(t, err, "commitment 1: replica commitment is not below the BLS12-381 scalar field modulus")
+	})
 }
 
 func TestCIDToReplicaCommitment(t *testing.T) {
@@ -161,6 +213,7 @@ func TestPieceCommitmentToCID(t *testing.T) {
 	randBytes := make([]byte, 32)
 	_, err := rand.Read(randBytes)
 	require.NoError(t, err)
+	randBytes[31] &= 0x3f
 
 	c, err := commcid.PieceCommitmentV1ToCID(randBytes)
 	require.NoError(t, err)
@@ -218,6 +271,93 @@ func TestCIDToPieceCommitment(t *testing.T) {
 	})
 }
 
+func TestCommitmentToCID(t *testing.T) {
+	randBytes := make([]byte, 32)
+	_, err := rand.Read(randBytes)
+	require.NoError(t, err)
+	randBytes[31] &= 0x3f
+
+	t.Run("matches the typed wrappers", func(t *testing.T) {
+		var codec, hashCode uint64 = cid.FilCommitmentUnsealed, multihash.SHA2_256_TRUNC254_PADDED
+		c, err := commcid.CommitmentToCID(commcid.FilMultiCodec(codec), commcid.FilMultiHash(hashCode), randBytes)
+		require.NoError(t, err)
+		expected, err := commcid.DataCommitmentV1ToCID(randBytes)
+		require.NoError(t, err)
+		require.Equal(t, expected, c)
+
+		c, err = commcid.CommitmentToCID(cid.FilCommitmentSealed, multihash.POSEIDON_BLS12_381_A1_FC1, randBytes)
+		require.NoError(t, err)
+		expected, err = commcid.ReplicaCommitmentV1ToCID(randBytes)
+		require.NoError(t, err)
+		require.Equal(t, expected, c)
+	})
+
+	t.Run("error on fil hash/codec mismatch", func(t *testing.T) {
+		_, err := commcid.CommitmentToCID(cid.FilCommitmentSealed, multihash.SHA2_256_TRUNC254_PADDED, randBytes)
+		require.ErrorIs(t, err, commcid.ErrIncorrectHash)
+	})
+
+	t.Run("error on non-fil codec", func(t *testing.T) {
+		_, err := commcid.CommitmentToCID(cid.DagCBOR, multihash.SHA2_256_TRUNC254_PADDED, randBytes)
+		require.ErrorIs(t, err, commcid.ErrIncorrectCodec)
+	})
+
+	t.Run("error on wrong commitment length", func(t *testing.T) {
+		_, err := commcid.CommitmentToCID(cid.FilCommitmentUnsealed, multihash.SHA2_256_TRUNC254_PADDED, randBytes[:31])
+		require.EqualError(t, err, "commitments must be 32 bytes long, got 31")
+	})
+}
+
+func TestCIDToCommitment(t *testing.T) {
+	randBytes := make([]byte, 32)
+	_, err := rand.Read(randBytes)
+	require.NoError(t, err)
+
+	t.Run("decodes data and replica commitments", func(t *testing.T) {
+		for _, tc := range []struct {
+			codec    commcid.FilMultiCodec
+			hashCode commcid.FilMultiHash
+		}{
+			{cid.FilCommitmentUnsealed, multihash.SHA2_256_TRUNC254_PADDED},
+			{cid.FilCommitmentSealed, multihash.POSEIDON_BLS12_381_A1_FC1},
+		} {
+			c := cid.NewCidV1(uint64(tc.codec), testMultiHash(uint64(tc.hashCode), randBytes, 0))
+			codec, hashCode, digest, err := commcid.CIDToCommitment(c)
+			require.NoError(t, err)
+			require.Equal(t, tc.codec, codec)
+			require.Equal(t, tc.hashCode, hashCode)
+			require.Equal(t, randBytes, digest)
+		}
+	})
+
+	t.Run("error on non-fil codec", func(t *testing.T) {
+		c := cid.NewCidV1(cid.DagCBOR, testMultiHash(multihash.SHA2_256_TRUNC254_PADDED, randBytes, 0))
+		_, _, _, err := commcid.CIDToCommitment(c)
+		require.ErrorIs(t, err, commcid.ErrIncorrectCodec)
+	})
+
+	t.Run("error on incorrectly formatted hash", func(t *testing.T) {
+		c := cid.NewCidV1(cid.FilCommitmentSealed, testMultiHash(multihash.POSEIDON_BLS12_381_A1_FC1, randBytes, 5))
+		_, _, _, err := commcid.CIDToCommitment(c)
+		require.Regexp(t, "^Error decoding data commitment hash:", err.Error())
+	})
+}
+
+func TestCommitmentConstructorsRejectWrongLength(t *testing.T) {
+	for name, toCID := range map[string]func([]byte) (cid.Cid, error){
+		"data":    commcid.DataCommitmentV1ToCID,
+		"replica": commcid.ReplicaCommitmentV1ToCID,
+		"piece":   commcid.PieceCommitmentV1ToCID,
+	} {
+		for _, size := range []int{0, 31, 33} {
+			c, err := toCID(make([]byte, size))
+			require.ErrorIs(t, err, commcid.ErrIncorrectLength, "%s commitment of %d bytes", name, size)
+			require.EqualError(t, err, fmt.Sprintf("commitments must be 32 bytes long, got %d", size))
+			require.Equal(t, cid.Undef, c)
+		}
+	}
+}
+
 func testMultiHash(code uint64, buf []byte, extra int) multihash.Multihash {
 	newBuf := make([]byte, varint.UvarintSize(code)+varint.UvarintSize(uint64(len(buf)))+len(buf)+extra)
 	n := varint.PutUvarint(newBuf, code)
@@ -226,3 +366,83 @@ func testMultiHash(code uint64, buf []byte, extra int) multihash.Multihash {
 	copy(newBuf[n:], buf)
 	return multihash.Multihash(newBuf)
 }
+
+func TestCIDToDataCommitmentV1Into(t *testing.T) {
+	randBytes := make([]byte, 32)
+	_, err := rand.Read(randBytes)
+	require.NoError(t, err)
+	hash := testMultiHash(multihash.SHA2_256_TRUNC254_PADDED, randBytes, 0)
+
+	dst := make([]byte, 32)
+	require.NoError(t, commcid.CIDToDataCommitmentV1Into(dst, cid.NewCidV1(cid.FilCommitmentUnsealed, hash)))
+	require.Equal(t, randBytes, dst)
+
+	// errors match CIDToDataCommitmentV1
+	for _, c := range []cid.Cid{
+		cid.NewCidV1(cid.DagCBOR, hash),
+		cid.NewCidV1(cid.FilCommitmentSealed, testMultiHash(multihash.POSEIDON_BLS12_381_A1_FC1, randBytes, 0)),
+		cid.NewCidV1(cid.FilCommitmentUnsealed, testMultiHash(multihash.POSEIDON_BLS12_381_A1_FC1, randBytes, 0)),
+		cid.NewCidV1(cid.FilCommitmentUnsealed, testMultiHash(multihash.SHA2_256_TRUNC254_PADDED, randBytes, 5)),
+	} {
+		_, expected := commcid.CIDToDataCommitmentV1(c)
+		require.Error(t, expected)
+		require.EqualError(t, commcid.CIDToDataCommitmentV1Into(dst, c), expected.Error())
+	}
+
+	t.Run("error on wrong destination length", func(t *testing.T) {
+		err := commcid.CIDToDataCommitmentV1Into(make([]byte, 31), cid.NewCidV1(cid.FilCommitmentUnsealed, hash))
+		require.EqualError(t, err, "destination must be 32 bytes long, got 31")
+	})
+
+	t.Run("does not allocate", func(t *testing.T) {
+		c := cid.NewCidV1(cid.FilCommitmentUnsealed, hash)
+		allocs := testing.AllocsPerRun(100, func() {
+			_ = commcid.CIDToDataCommitmentV1Into(dst, c)
+		})
+		require.Zero(t, allocs)
+	})
+}
+
+func BenchmarkCIDToDataCommitmentV1Into(b *testing.B) {
+	c := cid.MustParse(fixture127OfEach0123PieceCID)
+	dst := make([]byte, 32)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := commcid.CIDToDataCommitmentV1Into(dst, c); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	randBytes := make([]byte, 32)
+	_, err := rand.Read(randBytes)
+	require.NoError(t, err)
+
+	c := cid.NewCidV1(cid.FilCommitmentUnsealed, testMultiHash(multihash.SHA2_256_TRUNC254_PADDED, randBytes, 5))
+	_, err = commcid.CIDToDataCommitmentV1(c)
+	var decodeErr *commcid.DecodeError
+	require.True(t, errors.As(err, &decodeErr))
+	require.Equal(t, c, decodeErr.CID)
+	require.Equal(t, "data commitment hash", decodeErr.Stage)
+	var inconsistent multihash.ErrInconsistentLen
+	require.True(t, errors.As(err, &inconsistent))
+
+	t.Run("piece padding", func(t *testing.T) {
+		// a non-minimal uvarint padding
+		digest := append([]byte{0x80, 0x00, 0x02}, randBytes...)
+		c := cid.NewCidV1(cid.Raw, testMultiHash(commcid.FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE, digest, 0))
+		_, _, err := commcid.PieceMhCIDToDataCommitmentV1(c)
+		require.True(t, errors.As(err, &decodeErr))
+		require.Equal(t, "piece padding", decodeErr.Stage)
+		require.ErrorIs(t, err, varint.ErrNotMinimal)
+		require.Regexp(t, "^Error decoding piece padding:", err.Error())
+	})
+
+	t.Run("sentinels are still returned as is", func(t *testing.T) {
+		c := cid.NewCidV1(cid.FilCommitmentUnsealed, testMultiHash(multihash.POSEIDON_BLS12_381_A1_FC1, randBytes, 0))
+		_, err := commcid.CIDToDataCommitmentV1(c)
+		require.ErrorIs(t, err, commcid.ErrIncorrectHash)
+		require.False(t, errors.As(err, &decodeErr))
+	})
+}
@@ -0,0 +1,52 @@
+package commcid
+
+import (
+	"encoding"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// Commitment is a raw 32 byte data or replica commitment. It marshals to text
+// as a data commitment CID string, so it can be used directly in JSON configs
+// and CLI flags.
+type Commitment [nodeSize]byte
+
+var (
+	_ encoding.TextMarshaler   = Commitment{}
+	_ encoding.TextUnmarshaler = (*Commitment)(nil)
+)
+
+// DataCID returns the commitment as a data commitment CID
+func (c Commitment) DataCID() (cid.Cid, error) {
+	return DataCommitmentV1ToCID(c[:])
+}
+
+// ReplicaCID returns the commitment as a replica commitment CID
+func (c Commitment) ReplicaCID() (cid.Cid, error) {
+	return ReplicaCommitmentV1ToCID(c[:])
+}
+
+// MarshalText encodes the commitment as a data commitment CID string. Any 32
+// bytes are encoded, so a replica commitment still round-trips.
+func (c Commitment) MarshalText() ([]byte, error) {
+	dataCid, err := DataCommitmentV1ToCIDUnchecked(c[:])
+	if err != nil {
+		return nil, err
+	}
+	return []byte(dataCid.String()), nil
+}
+
+// UnmarshalText decodes a data or replica commitment CID string
+func (c *Commitment) UnmarshalText(text []byte) error {
+	decoded, err := cid.Decode(string(text))
+	if err != nil {
+		return xerrors.Errorf("Error decoding commitment CID: %w", err)
+	}
+	_, _, commX, err := CIDToCommitment(decoded)
+	if err != nil {
+		return err
+	}
+	*c = Commitment(commX)
+	return nil
+}
@@ -0,0 +1,53 @@
+package commcid_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitmentText(t *testing.T) {
+	commP, err := commcid.CIDToPieceCommitmentV1(cid.MustParse(fixture127OfEach0123PieceCID))
+	require.NoError(t, err)
+	c := commcid.Commitment(commP)
+
+	text, err := c.MarshalText()
+	require.NoError(t, err)
+	require.Equal(t, fixture127OfEach0123PieceCID, string(text))
+
+	type config struct {
+		CommD commcid.Commitment `json:"commD"`
+	}
+	encoded, err := json.Marshal(config{CommD: c})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"commD":"`+fixture127OfEach0123PieceCID+`"}`, string(encoded))
+	var decoded config
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	require.Equal(t, c, decoded.CommD)
+
+	t.Run("accepts replica commitment CIDs", func(t *testing.T) {
+		replicaCid, err := c.ReplicaCID()
+		require.NoError(t, err)
+		var decoded commcid.Commitment
+		require.NoError(t, decoded.UnmarshalText([]byte(replicaCid.String())))
+		require.Equal(t, c, decoded)
+	})
+
+	t.Run("renders either codec", func(t *testing.T) {
+		dataCid, err := c.DataCID()
+		require.NoError(t, err)
+		require.Equal(t, fixture127OfEach0123PieceCID, dataCid.String())
+		replicaCid, err := c.ReplicaCID()
+		require.NoError(t, err)
+		require.Equal(t, commcid.CommitmentTypeReplica, commcid.Classify(replicaCid))
+	})
+
+	t.Run("error on CIDs that are not commitments", func(t *testing.T) {
+		var decoded commcid.Commitment
+		require.ErrorIs(t, decoded.UnmarshalText([]byte(fixture32GiBEmptyV2)), commcid.ErrIncorrectCodec)
+		require.Error(t, decoded.UnmarshalText([]byte("not a cid")))
+	})
+}
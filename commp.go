@@ -0,0 +1,298 @@
+package commcid
+
+import (
+	"io"
+	"math/bits"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// nodeSize is the size of a single merkle node (and leaf) in bytes
+	nodeSize = 32
+	// fr32UnpaddedChunk is the number of raw bytes that expand to four leaves
+	// (fr32PaddedChunk bytes) after FR32 padding
+	fr32UnpaddedChunk = 127
+	fr32PaddedChunk   = 128
+	// maxTreeHeight is the tallest tree whose padded size still fits in a uint64
+	maxTreeHeight = 58
+	// readChunkSize is how much data the reader helpers pull in per step
+	readChunkSize = fr32UnpaddedChunk * 1024
+)
+
+// zeroCommitments[h] holds the root of a tree of height h whose leaves are
+// all zero
+var zeroCommitments = func() (zc [maxTreeHeight + 1][nodeSize]byte) {
+	for h := 1; h <= maxTreeHeight; h++ {
+		zc[h] = hashNodes(&zc[h-1], &zc[h-1])
+	}
+	return zc
+}()
+
+// hashNodes computes the parent of two merkle nodes: a sha256 digest with the
+// two most significant bits truncated so it remains a valid field element
+func hashNodes(left, right *[nodeSize]byte) [nodeSize]byte {
+	var buf [2 * nodeSize]byte
+	copy(buf[:nodeSize], left[:])
+	copy(buf[nodeSize:], right[:])
+	out := sum256(buf[:])
+	out[nodeSize-1] &= 0x3f
+	return out
+}
+
+// fr32Pad expands 127 bytes of raw data into 128 bytes (four 254-bit field
+// elements), inserting two zero bits after every 254 bits of input
+func fr32Pad(in *[fr32UnpaddedChunk]byte, out *[fr32PaddedChunk]byte) {
+	copy(out[:31], in[:31])
+
+	t := in[31] >> 6
+	out[31] = in[31] & 0x3f
+	var v byte
+
+	for i := 32; i < 64; i++ {
+		v = in[i]
+		out[i] = (v << 2) | t
+		t = v >> 6
+	}
+
+	t = v >> 4
+	out[63] &= 0x3f
+
+	for i := 64; i < 96; i++ {
+		v = in[i]
+		out[i] = (v << 4) | t
+		t = v >> 4
+	}
+
+	t = v >> 2
+	out[95] &= 0x3f
+
+	for i := 96; i < 127; i++ {
+		v = in[i]
+		out[i] = (v << 6) | t
+		t = v >> 2
+	}
+
+	out[127] = t & 0x3f
+}
+
+// FinalLeafCommitment returns the leaf node that a final fragment of fewer than
+// 32 bytes becomes when a piece ends with it on a chunk boundary: the fragment
+// is zero-filled to a full 127 byte chunk and FR32 padded, exactly as the
+// builder does, and the first resulting leaf is returned. A leaf holds only
+// 254 bits of data, so fragments longer than 31 bytes would spill into the
+// next leaf and are rejected.
+func FinalLeafCommitment(partial []byte) ([]byte, error) {
+	if len(partial) >= nodeSize {
+		return nil, xerrors.Errorf("fragment of %d bytes does not fit in a single %d byte leaf", len(partial), nodeSize)
+	}
+	var chunk [fr32UnpaddedChunk]byte
+	var padded [fr32PaddedChunk]byte
+	copy(chunk[:], partial)
+	fr32Pad(&chunk, &padded)
+	return padded[:nodeSize], nil
+}
+
+// paddedTreeHeight returns the height of the smallest tree that can hold the
+// given amount of raw data once FR32 padded
+func paddedTreeHeight(unpadded uint64) uint8 {
+	chunks := (unpadded + fr32UnpaddedChunk - 1) / fr32UnpaddedChunk
+	leaves := chunks * (fr32PaddedChunk / nodeSize)
+	return uint8(bits.Len64(leaves - 1))
+}
+
+// PieceBuilder incrementally computes the data commitment of a piece from its
+// unpadded bytes. The zero value is ready to use.
+//
+// It keeps a single pending node per tree layer: after n leaves, layer l holds
+// a node exactly when bit l of n is set.
+type PieceBuilder struct {
+	layers   [maxTreeHeight + 1][nodeSize]byte
+	leaves   uint64
+	unpadded uint64
+	closed   bool
+}
+
+// AddData consumes unpadded data. Every call except the final one must pass a
+// multiple of 127 bytes; a trailing partial chunk is zero-filled and closes
+// the builder to further data.
+func (b *PieceBuilder) AddData(p []byte) error {
+	return b.addData(p, nil)
+}
+
+// nodeObserver is told about every complete node as the tree is built, by its
+// layer and index within that layer
+type nodeObserver func(layer uint8, index uint64, node *[nodeSize]byte)
+
+func (b *PieceBuilder) addData(p []byte, observe nodeObserver) error {
+	if b.closed {
+		return xerrors.New("data added after final partial chunk")
+	}
+
+	var chunk [fr32UnpaddedChunk]byte
+	var padded [fr32PaddedChunk]byte
+	for len(p) > 0 {
+		n := copy(chunk[:], p)
+		if n < fr32UnpaddedChunk {
+			clear(chunk[n:])
+			b.closed = true
+		}
+		p = p[n:]
+		b.unpadded += uint64(n)
+
+		fr32Pad(&chunk, &padded)
+		for i := 0; i < fr32PaddedChunk; i += nodeSize {
+			b.addLeaf((*[nodeSize]byte)(padded[i:i+nodeSize]), observe)
+		}
+	}
+	return nil
+}
+
+func (b *PieceBuilder) addLeaf(leaf *[nodeSize]byte, observe nodeObserver) {
+	node := *leaf
+	layer := 0
+	n := b.leaves
+	for {
+		if observe != nil {
+			observe(uint8(layer), n, &node)
+		}
+		if n&1 == 0 {
+			break
+		}
+		node = hashNodes(&b.layers[layer], &node)
+		layer++
+		n >>= 1
+	}
+	b.layers[layer] = node
+	b.leaves++
+}
+
+// Digest returns the data commitment along with the unpadded and padded piece
+// sizes, filling any missing leaves with zero subtrees
+func (b *PieceBuilder) Digest() ([]byte, uint64, uint64, error) {
+	if b.unpadded < MinUnpaddedPieceSize {
+		return nil, 0, 0, xerrors.Errorf("piece payload must be at least %d bytes, got %d", MinUnpaddedPieceSize, b.unpadded)
+	}
+
+	height := paddedTreeHeight(b.unpadded)
+	root := b.root(height, nil)
+	return root[:], b.unpadded, nodeSize << height, nil
+}
+
+func (b *PieceBuilder) root(height uint8, observe nodeObserver) [nodeSize]byte {
+	if b.leaves == 1<<height {
+		return b.layers[height]
+	}
+
+	var node [nodeSize]byte
+	carry := false
+	for layer := uint8(0); layer < height; layer++ {
+		pending := (b.leaves>>layer)&1 == 1
+		switch {
+		case carry && pending:
+			node = hashNodes(&b.layers[layer], &node)
+		case carry:
+			node = hashNodes(&node, &zeroCommitments[layer])
+		case pending:
+			node = hashNodes(&b.layers[layer], &zeroCommitments[layer])
+			carry = true
+		}
+		if carry && observe != nil {
+			observe(layer+1, b.leaves>>(layer+1), &node)
+		}
+	}
+	return node
+}
+
+// LargestCompleteSubtree returns the root of the largest aligned subtree whose
+// leaves have all been hashed, along with the number of padded bytes it
+// covers. The subtree always starts at the beginning of the piece. ok is false
+// until the first leaf has been added.
+func (b *PieceBuilder) LargestCompleteSubtree() (root []byte, coveredBytes uint64, ok bool) {
+	if b.leaves == 0 {
+		return nil, 0, false
+	}
+	layer := bits.Len64(b.leaves) - 1
+	node := b.layers[layer]
+	return node[:], nodeSize << layer, true
+}
+
+// DataCommitmentV1FromReader computes the raw data commitment (commP) of all
+// data read from r, along with the unpadded and padded piece sizes, without
+// constructing a CID
+func DataCommitmentV1FromReader(r io.Reader) ([]byte, uint64, uint64, error) {
+	return dataCommitmentFromReader(r, readChunkSize)
+}
+
+// dataCommitmentFromReader hashes r through a read buffer of bufSize bytes,
+// which must be a multiple of 127
+func dataCommitmentFromReader(r io.Reader, bufSize int) ([]byte, uint64, uint64, error) {
+	var b PieceBuilder
+	if err := b.readFrom(r, make([]byte, bufSize), nil, nil); err != nil {
+		return nil, 0, 0, err
+	}
+	return b.Digest()
+}
+
+// readFrom adds all data from r to the builder, reading through buf, whose
+// length must be a multiple of 127. If observe is set it is passed every node
+// built, and if afterChunk is set it is called after every full buffer.
+func (b *PieceBuilder) readFrom(r io.Reader, buf []byte, observe nodeObserver, afterChunk func() error) error {
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if werr := b.addData(buf[:n], observe); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return xerrors.Errorf("reading piece data: %w", err)
+		}
+		if afterChunk != nil {
+			if err := afterChunk(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// PieceCIDFromReader computes the v1 piece CID of all data read from r and
+// returns it along with the padded piece size
+func PieceCIDFromReader(r io.Reader) (cid.Cid, uint64, error) {
+	commP, _, paddedSize, err := DataCommitmentV1FromReader(r)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	c, err := PieceCommitmentV1ToCID(commP)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	return c, paddedSize, nil
+}
+
+// PieceCIDV2FromReader computes the v2 piece CID of all data read from r and
+// returns it along with the unpadded data size, streaming the data through the
+// hasher in fixed-size chunks
+func PieceCIDV2FromReader(r io.Reader) (cid.Cid, uint64, error) {
+	var b PieceBuilder
+	if err := b.readFrom(r, make([]byte, readChunkSize), nil, nil); err != nil {
+		return cid.Undef, 0, err
+	}
+	if b.unpadded == 0 {
+		return cid.Undef, 0, xerrors.New("no piece data read")
+	}
+
+	commP, unpaddedSize, _, err := b.Digest()
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	c, err := DataCommitmentV1ToPieceMhCID(commP, unpaddedSize)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	return c, unpaddedSize, nil
+}
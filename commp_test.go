@@ -0,0 +1,123 @@
+package commcid_test
+
+import (
+	"bytes"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+// fixture127OfEach0123 is 127 bytes each of 0x00, 0x01, 0x02 and 0x03
+var fixture127OfEach0123 = func() []byte {
+	var data []byte
+	for i := 0; i < 4; i++ {
+		data = append(data, bytes.Repeat([]byte{byte(i)}, 127)...)
+	}
+	return data
+}()
+
+const fixture127OfEach0123PieceCID = "baga6ea4seaqes3nobte6ezpp4wqan2age2s5yxcatzotcvobhgcmv5wi2xh5mbi"
+
+func TestPieceCIDFromReader(t *testing.T) {
+	c, paddedSize, err := commcid.PieceCIDFromReader(bytes.NewReader(fixture127OfEach0123))
+	require.NoError(t, err)
+	require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+	require.Equal(t, uint64(512), paddedSize)
+
+	t.Run("error on payload below minimum size", func(t *testing.T) {
+		_, _, err := commcid.PieceCIDFromReader(bytes.NewReader(make([]byte, 126)))
+		require.EqualError(t, err, "piece payload must be at least 127 bytes, got 126")
+	})
+}
+
+func TestDataCommitmentV1FromReader(t *testing.T) {
+	digest, unpaddedSize, paddedSize, err := commcid.DataCommitmentV1FromReader(bytes.NewReader(fixture127OfEach0123))
+	require.NoError(t, err)
+	require.Equal(t, uint64(508), unpaddedSize)
+	require.Equal(t, uint64(512), paddedSize)
+
+	expected, err := commcid.CIDToPieceCommitmentV1(cid.MustParse(fixture127OfEach0123PieceCID))
+	require.NoError(t, err)
+	require.Equal(t, expected, digest)
+
+	t.Run("zero payload pads to the zero commitment", func(t *testing.T) {
+		digest, unpaddedSize, paddedSize, err := commcid.DataCommitmentV1FromReader(bytes.NewReader(make([]byte, 127*16)))
+		require.NoError(t, err)
+		require.Equal(t, uint64(127*16), unpaddedSize)
+		require.Equal(t, uint64(2048), paddedSize)
+
+		c, err := commcid.PieceCommitmentV1ToCID(digest)
+		require.NoError(t, err)
+		require.Equal(t, "baga6ea4seaqpy7usqklokfx2vxuynmupslkeutzexe2uqurdg5vhtebhxqmpqmy", c.String())
+	})
+}
+
+func TestPieceBuilderLargestCompleteSubtree(t *testing.T) {
+	var b commcid.PieceBuilder
+
+	_, _, ok := b.LargestCompleteSubtree()
+	require.False(t, ok)
+
+	expectedCovered := []uint64{128, 256, 256, 512}
+	for i, covered := range expectedCovered {
+		require.NoError(t, b.AddData(fixture127OfEach0123[i*127:(i+1)*127]))
+		_, coveredBytes, ok := b.LargestCompleteSubtree()
+		require.True(t, ok)
+		require.Equal(t, covered, coveredBytes)
+	}
+
+	// once the whole tree is hashed the largest subtree is the piece itself
+	root, _, _ := b.LargestCompleteSubtree()
+	expected, err := commcid.CIDToPieceCommitmentV1(cid.MustParse(fixture127OfEach0123PieceCID))
+	require.NoError(t, err)
+	require.Equal(t, expected, root)
+
+	t.Run("error on data after partial chunk", func(t *testing.T) {
+		var b commcid.PieceBuilder
+		require.NoError(t, b.AddData(make([]byte, 200)))
+		require.EqualError(t, b.AddData(make([]byte, 127)), "data added after final partial chunk")
+	})
+}
+
+func TestFinalLeafCommitment(t *testing.T) {
+	for _, size := range []int{1, 16, 31} {
+		partial := fixture127OfEach0123[127*3 : 127*3+size]
+		leaf, err := commcid.FinalLeafCommitment(partial)
+		require.NoError(t, err)
+		require.Len(t, leaf, 32)
+
+		// the builder zero-fills the fragment into a chunk of four leaves, of
+		// which only the first holds data
+		var b commcid.PieceBuilder
+		require.NoError(t, b.AddData(partial))
+		expected, _, ok := b.LargestCompleteSubtree()
+		require.True(t, ok)
+		root, err := commcid.CommitmentFromSparseLeaves(map[uint64][]byte{0: leaf}, 2)
+		require.NoError(t, err)
+		require.Equal(t, expected, root, "fragment of %d bytes", size)
+	}
+
+	_, err := commcid.FinalLeafCommitment(make([]byte, 32))
+	require.EqualError(t, err, "fragment of 32 bytes does not fit in a single 32 byte leaf")
+}
+
+func TestPieceCIDV2FromReader(t *testing.T) {
+	c, unpaddedSize, err := commcid.PieceCIDV2FromReader(bytes.NewReader(fixture127OfEach0123))
+	require.NoError(t, err)
+	require.Equal(t, uint64(508), unpaddedSize)
+	expected, err := commcid.ConvertDataCommitmentV1V1CIDtoPieceMhCID(cid.MustParse(fixture127OfEach0123PieceCID), 508)
+	require.NoError(t, err)
+	require.Equal(t, expected, c)
+
+	t.Run("error on empty reader", func(t *testing.T) {
+		_, _, err := commcid.PieceCIDV2FromReader(bytes.NewReader(nil))
+		require.EqualError(t, err, "no piece data read")
+	})
+
+	t.Run("error on payload below minimum size", func(t *testing.T) {
+		_, _, err := commcid.PieceCIDV2FromReader(bytes.NewReader(make([]byte, 126)))
+		require.EqualError(t, err, "piece payload must be at least 127 bytes, got 126")
+	})
+}
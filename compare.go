@@ -0,0 +1,38 @@
+package commcid
+
+import (
+	"crypto/subtle"
+
+	"github.com/ipfs/go-cid"
+)
+
+// CommitmentsEqual reports whether a and b are the same 32 byte commitment,
+// in time that depends only on their lengths. It is false unless both are 32
+// bytes long.
+func CommitmentsEqual(a, b []byte) bool {
+	if len(a) != nodeSize || len(b) != nodeSize {
+		return false
+	}
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
+
+// PieceCIDsEqual reports whether a and b commit to the same data or replica,
+// comparing the decoded commitments in constant time. When both are v2 piece
+// CIDs their sizes must match too, so pieces that only share a root differ.
+// Otherwise only the commitment and its kind are compared: a v1 and a v2
+// piece CID of the same piece are equal even though the v2 CID also carries
+// the size, while a data and a replica commitment with the same bytes are not.
+// It is false if either CID is not a commitment.
+func PieceCIDsEqual(a, b cid.Cid) bool {
+	keyA, paddingA, errA := commitmentKeyAndPadding(a)
+	keyB, paddingB, errB := commitmentKeyAndPadding(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	// a tree height is only set for v2 piece CIDs
+	if keyA[1] == 0 || keyB[1] == 0 {
+		keyA, keyB = foldCommitmentKey(keyA), foldCommitmentKey(keyB)
+		paddingA, paddingB = [8]byte{}, [8]byte{}
+	}
+	return subtle.ConstantTimeCompare(keyA[:], keyB[:])&subtle.ConstantTimeCompare(paddingA[:], paddingB[:]) == 1
+}
@@ -0,0 +1,56 @@
+package commcid_test
+
+import (
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitmentsEqual(t *testing.T) {
+	commitments := testRandomCommitments(t, 2)
+	require.True(t, commcid.CommitmentsEqual(commitments[0], append([]byte{}, commitments[0]...)))
+	require.False(t, commcid.CommitmentsEqual(commitments[0], commitments[1]))
+	require.False(t, commcid.CommitmentsEqual(commitments[0][:31], commitments[0][:31]))
+	require.False(t, commcid.CommitmentsEqual(nil, nil))
+}
+
+func TestPieceCIDsEqual(t *testing.T) {
+	v1 := cid.MustParse(fixture32GiBEmptyV1)
+	v2 := cid.MustParse(fixture32GiBEmptyV2)
+	require.True(t, commcid.PieceCIDsEqual(v1, v1))
+	require.True(t, commcid.PieceCIDsEqual(v1, v2))
+	require.True(t, commcid.PieceCIDsEqual(v2, v1))
+
+	other := cid.MustParse(fixture127OfEach0123PieceCID)
+	require.False(t, commcid.PieceCIDsEqual(v1, other))
+
+	// the same bytes as a replica commitment are a different commitment
+	commD, err := commcid.CIDToDataCommitmentV1(v1)
+	require.NoError(t, err)
+	replicaCid, err := commcid.ReplicaCommitmentV1ToCID(commD)
+	require.NoError(t, err)
+	require.False(t, commcid.PieceCIDsEqual(v1, replicaCid))
+
+	require.False(t, commcid.PieceCIDsEqual(cid.Undef, cid.Undef))
+
+	t.Run("v2 piece CIDs sharing a root but not a size differ", func(t *testing.T) {
+		plus4, plus5 := cid.MustParse(fixture127Plus4ZerosPieceCID), cid.MustParse(fixture127Plus5ZerosPieceCID)
+		require.True(t, commcid.PieceCIDsEqual(plus4, plus4))
+		require.False(t, commcid.PieceCIDsEqual(plus4, plus5))
+
+		v1, _, err := commcid.ConvertDataCommitmentV1PieceMhCIDToV1CID(plus4)
+		require.NoError(t, err)
+		require.True(t, commcid.PieceCIDsEqual(v1, plus4))
+		require.True(t, commcid.PieceCIDsEqual(plus5, v1))
+
+		// sizes too large for CommitmentKey still compare
+		huge, err := commcid.DataCommitmentV1ToPieceMhCID(commD, 1<<50)
+		require.NoError(t, err)
+		hugeV1, err := commcid.DataCommitmentV1ToCID(commD)
+		require.NoError(t, err)
+		require.True(t, commcid.PieceCIDsEqual(huge, huge))
+		require.True(t, commcid.PieceCIDsEqual(huge, hugeV1))
+	})
+}
@@ -0,0 +1,128 @@
+package commcid
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// SubtreeCommitmentsFromReader splits all data read from r into runs that each
+// fill a subtree of the given height once FR32 padded, and returns the root
+// of every subtree in order along with the total unpadded size. The last run
+// is zero padded to a full subtree, so the roots are exactly the nodes at
+// subtreeHeight of the tree over the whole piece.
+func SubtreeCommitmentsFromReader(r io.Reader, subtreeHeight uint8) ([][]byte, uint64, error) {
+	if err := validateSubtreeHeight(subtreeHeight); err != nil {
+		return nil, 0, err
+	}
+	capacity := unpaddedCapacity(subtreeHeight)
+	buf := make([]byte, min(readChunkSize, capacity))
+
+	var roots [][]byte
+	var total uint64
+	for {
+		var b PieceBuilder
+		if err := b.readFrom(io.LimitReader(r, int64(capacity)), buf, nil, nil); err != nil {
+			return nil, 0, err
+		}
+		if b.unpadded == 0 {
+			break
+		}
+		root := b.root(subtreeHeight, nil)
+		roots = append(roots, root[:])
+		total += b.unpadded
+		if b.unpadded < capacity {
+			break
+		}
+	}
+
+	if total < MinUnpaddedPieceSize {
+		return nil, 0, xerrors.Errorf("piece payload must be at least %d bytes, got %d", MinUnpaddedPieceSize, total)
+	}
+	return roots, total, nil
+}
+
+// PieceCIDFromSubtreeCommitments combines the roots returned by
+// SubtreeCommitmentsFromReader for totalUnpadded bytes of data into the v1
+// piece CID and padded piece size of the whole piece. Roots missing from the
+// end of the tree are filled in with zero subtrees. The piece must be at least
+// as large as one subtree, since a smaller piece's root lies inside it.
+func PieceCIDFromSubtreeCommitments(roots [][]byte, subtreeHeight uint8, totalUnpadded uint64) (cid.Cid, uint64, error) {
+	if err := validateSubtreeHeight(subtreeHeight); err != nil {
+		return cid.Undef, 0, err
+	}
+	if err := validatePayloadSize(totalUnpadded); err != nil {
+		return cid.Undef, 0, err
+	}
+	height := paddedTreeHeight(totalUnpadded)
+	if height < subtreeHeight {
+		return cid.Undef, 0, xerrors.Errorf("piece of %d bytes is smaller than a subtree of height %d", totalUnpadded, subtreeHeight)
+	}
+	capacity := unpaddedCapacity(subtreeHeight)
+	if expected := (totalUnpadded + capacity - 1) / capacity; uint64(len(roots)) != expected {
+		return cid.Undef, 0, xerrors.Errorf("expected %d subtree roots for %d bytes, got %d", expected, totalUnpadded, len(roots))
+	}
+
+	layer := make([][nodeSize]byte, len(roots))
+	for i, root := range roots {
+		if len(root) != nodeSize {
+			return cid.Undef, 0, xerrors.Errorf("subtree root %d must be %d bytes long, got %d", i, nodeSize, len(root))
+		}
+		layer[i] = [nodeSize]byte(root)
+	}
+	for h := subtreeHeight; h < height; h++ {
+		if len(layer)%2 == 1 {
+			layer = append(layer, zeroCommitments[h])
+		}
+		for i := 0; i < len(layer)/2; i++ {
+			layer[i] = hashNodes(&layer[2*i], &layer[2*i+1])
+		}
+		layer = layer[:len(layer)/2]
+	}
+
+	c, err := PieceCommitmentV1ToCID(layer[0][:])
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	return c, nodeSize << height, nil
+}
+
+// VerifySubtreeCommitment recomputes the root of the subtree of the given
+// height over all data read from data and reports whether it equals
+// claimedRoot. The data must fit in the subtree; less than a full subtree is
+// zero padded, as for the final subtree of a piece.
+func VerifySubtreeCommitment(data io.Reader, claimedRoot []byte, subtreeHeight uint8) (bool, error) {
+	if err := validateSubtreeHeight(subtreeHeight); err != nil {
+		return false, err
+	}
+	if len(claimedRoot) != nodeSize {
+		return false, xerrors.Errorf("claimed root must be %d bytes long, got %d", nodeSize, len(claimedRoot))
+	}
+	capacity := unpaddedCapacity(subtreeHeight)
+
+	var b PieceBuilder
+	buf := make([]byte, min(readChunkSize, capacity))
+	if err := b.readFrom(io.LimitReader(data, int64(capacity)+1), buf, nil, nil); err != nil {
+		return false, err
+	}
+	switch {
+	case b.unpadded == 0:
+		return false, xerrors.New("no subtree data read")
+	case b.unpadded > capacity:
+		return false, xerrors.Errorf("data exceeds the %d bytes a subtree of height %d holds", capacity, subtreeHeight)
+	}
+
+	root := b.root(subtreeHeight, nil)
+	return bytes.Equal(root[:], claimedRoot), nil
+}
+
+// validateSubtreeHeight returns an error unless a subtree of the given height
+// holds at least one full FR32 chunk and fits in a piece
+func validateSubtreeHeight(height uint8) error {
+	if height < 2 || height > maxTreeHeight {
+		return xerrors.Errorf("subtree height %d out of range", height)
+	}
+	return nil
+}
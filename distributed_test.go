@@ -0,0 +1,132 @@
+package commcid_test
+
+import (
+	"bytes"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubtreeCommitmentsFromReader(t *testing.T) {
+	expected, err := commcid.CIDToPieceCommitmentV1(cid.MustParse(fixture127OfEach0123PieceCID))
+	require.NoError(t, err)
+
+	// the fixture is a height 4 tree, so subtrees of height 2 are its four
+	// 127 byte chunks
+	for _, subtreeHeight := range []uint8{2, 3, 4} {
+		roots, total, err := commcid.SubtreeCommitmentsFromReader(bytes.NewReader(fixture127OfEach0123), subtreeHeight)
+		require.NoError(t, err)
+		require.Equal(t, uint64(508), total)
+		require.Len(t, roots, 1<<(4-subtreeHeight))
+
+		leaves := make(map[uint64][]byte)
+		for i, root := range roots {
+			leaves[uint64(i)] = root
+		}
+		combined, err := commcid.CommitmentFromSparseLeaves(leaves, 4-subtreeHeight)
+		require.NoError(t, err)
+		require.Equal(t, expected, combined, "subtree height %d", subtreeHeight)
+	}
+
+	t.Run("partial final subtree", func(t *testing.T) {
+		data := append(bytes.Repeat(fixture127OfEach0123, 3), fixture127OfEach0123[:100]...)
+		c, paddedSize, err := commcid.PieceCIDFromReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		expected, err := commcid.CIDToPieceCommitmentV1(c)
+		require.NoError(t, err)
+
+		roots, total, err := commcid.SubtreeCommitmentsFromReader(bytes.NewReader(data), 4)
+		require.NoError(t, err)
+		require.Equal(t, uint64(len(data)), total)
+		require.Len(t, roots, 4)
+
+		height := commcid.Fr32PaddedSizeToV1TreeHeight(paddedSize)
+		combined, err := commcid.CommitmentFromSparseLeaves(map[uint64][]byte{0: roots[0], 1: roots[1], 2: roots[2], 3: roots[3]}, height-4)
+		require.NoError(t, err)
+		require.Equal(t, expected, combined)
+	})
+
+	t.Run("error on subtree height out of range", func(t *testing.T) {
+		_, _, err := commcid.SubtreeCommitmentsFromReader(bytes.NewReader(fixture127OfEach0123), 1)
+		require.EqualError(t, err, "subtree height 1 out of range")
+	})
+
+	t.Run("error on payload below minimum size", func(t *testing.T) {
+		_, _, err := commcid.SubtreeCommitmentsFromReader(bytes.NewReader(make([]byte, 100)), 2)
+		require.EqualError(t, err, "piece payload must be at least 127 bytes, got 100")
+	})
+}
+
+func TestPieceCIDFromSubtreeCommitments(t *testing.T) {
+	for _, subtreeHeight := range []uint8{2, 3, 4} {
+		roots, total, err := commcid.SubtreeCommitmentsFromReader(bytes.NewReader(fixture127OfEach0123), subtreeHeight)
+		require.NoError(t, err)
+		c, paddedSize, err := commcid.PieceCIDFromSubtreeCommitments(roots, subtreeHeight, total)
+		require.NoError(t, err)
+		require.Equal(t, fixture127OfEach0123PieceCID, c.String(), "subtree height %d", subtreeHeight)
+		require.Equal(t, uint64(512), paddedSize)
+	}
+
+	t.Run("zero subtrees fill the end of the tree", func(t *testing.T) {
+		for _, data := range [][]byte{
+			bytes.Repeat(fixture127OfEach0123, 3),
+			bytes.Repeat(fixture127OfEach0123, 5),
+			append(bytes.Repeat(fixture127OfEach0123, 4), 1),
+		} {
+			expected, expectedSize, err := commcid.PieceCIDFromReader(bytes.NewReader(data))
+			require.NoError(t, err)
+
+			roots, total, err := commcid.SubtreeCommitmentsFromReader(bytes.NewReader(data), 4)
+			require.NoError(t, err)
+			c, paddedSize, err := commcid.PieceCIDFromSubtreeCommitments(roots, 4, total)
+			require.NoError(t, err)
+			require.Equal(t, expected, c, "%d bytes", len(data))
+			require.Equal(t, expectedSize, paddedSize)
+		}
+	})
+
+	t.Run("error on wrong number of roots", func(t *testing.T) {
+		roots, total, err := commcid.SubtreeCommitmentsFromReader(bytes.NewReader(fixture127OfEach0123), 2)
+		require.NoError(t, err)
+		_, _, err = commcid.PieceCIDFromSubtreeCommitments(roots[:3], 2, total)
+		require.EqualError(t, err, "expected 4 subtree roots for 508 bytes, got 3")
+	})
+
+	t.Run("error on piece smaller than a subtree", func(t *testing.T) {
+		roots, total, err := commcid.SubtreeCommitmentsFromReader(bytes.NewReader(fixture127OfEach0123), 5)
+		require.NoError(t, err)
+		_, _, err = commcid.PieceCIDFromSubtreeCommitments(roots, 5, total)
+		require.EqualError(t, err, "piece of 508 bytes is smaller than a subtree of height 5")
+	})
+}
+
+func TestVerifySubtreeCommitment(t *testing.T) {
+	data := append(bytes.Repeat(fixture127OfEach0123, 2), fixture127OfEach0123[:100]...)
+	roots, _, err := commcid.SubtreeCommitmentsFromReader(bytes.NewReader(data), 3)
+	require.NoError(t, err)
+
+	for i, root := range roots {
+		subtree := data[i*254 : min((i+1)*254, len(data))]
+		ok, err := commcid.VerifySubtreeCommitment(bytes.NewReader(subtree), root, 3)
+		require.NoError(t, err)
+		require.True(t, ok, "subtree %d", i)
+	}
+
+	tampered := bytes.Clone(data[:254])
+	tampered[10] ^= 0xff
+	ok, err := commcid.VerifySubtreeCommitment(bytes.NewReader(tampered), roots[0], 3)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	t.Run("error on data past the subtree", func(t *testing.T) {
+		_, err := commcid.VerifySubtreeCommitment(bytes.NewReader(data[:255]), roots[0], 3)
+		require.EqualError(t, err, "data exceeds the 254 bytes a subtree of height 3 holds")
+	})
+
+	t.Run("error on empty data", func(t *testing.T) {
+		_, err := commcid.VerifySubtreeCommitment(bytes.NewReader(nil), roots[0], 3)
+		require.EqualError(t, err, "no subtree data read")
+	})
+}
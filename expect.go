@@ -0,0 +1,45 @@
+package commcid
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// ExpectCommitmentHex returns an error unless the raw commitment carried by the
+// data, replica or v2 piece CID equals expectedHex. The comparison ignores case
+// and an optional 0x prefix.
+func ExpectCommitmentHex(c cid.Cid, expectedHex string) error {
+	commX, err := commitmentDigest(c)
+	if err != nil {
+		return err
+	}
+
+	expected := strings.ToLower(strings.TrimPrefix(expectedHex, "0x"))
+	if actual := hex.EncodeToString(commX); actual != expected {
+		return xerrors.Errorf("commitment mismatch: expected %s, got %s", expected, actual)
+	}
+	return nil
+}
+
+// PieceCIDMatchesPrefix computes the v1 piece CID of all data read from r and
+// reports whether its raw commitment begins with expectedPrefix. The whole
+// stream is always hashed, since only the final root can be compared.
+func PieceCIDMatchesPrefix(r io.Reader, expectedPrefix []byte) (bool, cid.Cid, error) {
+	if len(expectedPrefix) > nodeSize {
+		return false, cid.Undef, xerrors.Errorf("prefix of %d bytes is longer than a %d byte commitment", len(expectedPrefix), nodeSize)
+	}
+	commP, _, _, err := DataCommitmentV1FromReader(r)
+	if err != nil {
+		return false, cid.Undef, err
+	}
+	c, err := PieceCommitmentV1ToCID(commP)
+	if err != nil {
+		return false, cid.Undef, err
+	}
+	return bytes.HasPrefix(commP, expectedPrefix), c, nil
+}
@@ -0,0 +1,46 @@
+package commcid_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+const fixture32GiBEmptyHex = "077e5fde35c50a9303a55009e3498a4ebedff39c42b710b730d8ec7ac7afa63e"
+
+func TestExpectCommitmentHex(t *testing.T) {
+	for _, fixture := range []string{fixture32GiBEmptyV1, fixture32GiBEmptyV2} {
+		c := cid.MustParse(fixture)
+		require.NoError(t, commcid.ExpectCommitmentHex(c, fixture32GiBEmptyHex))
+		require.NoError(t, commcid.ExpectCommitmentHex(c, "0x"+strings.ToUpper(fixture32GiBEmptyHex)))
+	}
+
+	err := commcid.ExpectCommitmentHex(cid.MustParse(fixture127OfEach0123PieceCID), fixture32GiBEmptyHex)
+	require.Regexp(t, "^commitment mismatch: expected "+fixture32GiBEmptyHex+", got [0-9a-f]{64}$", err.Error())
+}
+
+func TestPieceCIDMatchesPrefix(t *testing.T) {
+	commP, err := commcid.CIDToPieceCommitmentV1(cid.MustParse(fixture127OfEach0123PieceCID))
+	require.NoError(t, err)
+
+	matches, c, err := commcid.PieceCIDMatchesPrefix(bytes.NewReader(fixture127OfEach0123), commP[:4])
+	require.NoError(t, err)
+	require.True(t, matches)
+	require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+
+	mismatched := append([]byte{}, commP[:4]...)
+	mismatched[3]++
+	matches, c, err = commcid.PieceCIDMatchesPrefix(bytes.NewReader(fixture127OfEach0123), mismatched)
+	require.NoError(t, err)
+	require.False(t, matches)
+	require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+
+	t.Run("error on prefix longer than a commitment", func(t *testing.T) {
+		_, _, err := commcid.PieceCIDMatchesPrefix(bytes.NewReader(fixture127OfEach0123), make([]byte, 33))
+		require.EqualError(t, err, "prefix of 33 bytes is longer than a 32 byte commitment")
+	})
+}
@@ -0,0 +1,17 @@
+package commcid
+
+// UseScalarHashing switches node hashing to the scalar implementation until
+// the returned function is called
+func UseScalarHashing() (restore func()) {
+	sum256 = scalarSum256
+	return func() { sum256 = acceleratedSum256 }
+}
+
+// WriteCarV1 writes the CARv1 that PieceCIDFromUnixFS hashes
+var WriteCarV1 = writeCarV1
+
+// SetAcceptedForTest makes the hasher behave as if n bytes had already been
+// written, without hashing them
+func (h *StreamingPieceHasher) SetAcceptedForTest(n uint64) {
+	h.builder.unpadded = n
+}
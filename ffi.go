@@ -0,0 +1,33 @@
+package commcid
+
+import (
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// CommitmentToFFIArray extracts the raw commitment from a data, replica or v2
+// piece CID as a fixed-size array, matching the layout expected across the
+// FFI boundary with the proofs library
+func CommitmentToFFIArray(c cid.Cid) ([32]byte, error) {
+	var out [32]byte
+	commX, err := commitmentDigest(c)
+	if err != nil {
+		return out, err
+	}
+	copy(out[:], commX)
+	return out, nil
+}
+
+// CommitmentFromFFIArray converts a raw commitment received across the FFI
+// boundary back to a CID of the given type. v2 piece CIDs cannot be built this
+// way as the array does not carry the piece size.
+func CommitmentFromFFIArray(commX [32]byte, t CommitmentType) (cid.Cid, error) {
+	switch t {
+	case CommitmentTypeData:
+		return DataCommitmentV1ToCID(commX[:])
+	case CommitmentTypeReplica:
+		return ReplicaCommitmentV1ToCID(commX[:])
+	default:
+		return cid.Undef, xerrors.Errorf("cannot build a %s from a raw commitment", t)
+	}
+}
@@ -0,0 +1,45 @@
+package commcid_test
+
+import (
+	"crypto/rand"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitmentFFIArrayRoundTrip(t *testing.T) {
+	var commX [32]byte
+	_, err := rand.Read(commX[:])
+	require.NoError(t, err)
+	commX[31] &= 0x3f
+
+	for _, ct := range []commcid.CommitmentType{commcid.CommitmentTypeData, commcid.CommitmentTypeReplica} {
+		c, err := commcid.CommitmentFromFFIArray(commX, ct)
+		require.NoError(t, err)
+		require.Equal(t, ct, commcid.Classify(c))
+
+		out, err := commcid.CommitmentToFFIArray(c)
+		require.NoError(t, err)
+		require.Equal(t, commX, out)
+	}
+
+	t.Run("v2 piece CID to array", func(t *testing.T) {
+		c, err := commcid.DataCommitmentV1ToPieceMhCID(commX[:], 127)
+		require.NoError(t, err)
+		out, err := commcid.CommitmentToFFIArray(c)
+		require.NoError(t, err)
+		require.Equal(t, commX, out)
+
+		_, err = commcid.CommitmentFromFFIArray(commX, commcid.CommitmentTypePieceV2)
+		require.EqualError(t, err, "cannot build a v2 piece commitment from a raw commitment")
+	})
+
+	t.Run("error on non-fil codec", func(t *testing.T) {
+		c := cid.NewCidV1(cid.DagCBOR, testMultiHash(multihash.SHA2_256_TRUNC254_PADDED, commX[:], 0))
+		_, err := commcid.CommitmentToFFIArray(c)
+		require.EqualError(t, err, commcid.ErrIncorrectCodec.Error())
+	})
+}
@@ -0,0 +1,20 @@
+package commcid
+
+import (
+	"path/filepath"
+
+	"github.com/ipfs/go-cid"
+)
+
+// PieceCIDToFilename returns a relative storage path for the piece identified
+// by c: its canonical base32 string, which is already filesystem safe, inside a
+// shard directory named after the two characters before the last one. The
+// leading characters of piece CIDs share their codec and hash prefix, so the
+// shard is taken from the commitment at the end instead, as flatfs does.
+func PieceCIDToFilename(c cid.Cid) string {
+	s := c.String()
+	if len(s) < 3 {
+		return s
+	}
+	return filepath.Join(s[len(s)-3:len(s)-1], s)
+}
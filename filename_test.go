@@ -0,0 +1,26 @@
+package commcid_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPieceCIDToFilename(t *testing.T) {
+	fixtures := []string{fixture127OfEach0123PieceCID, fixture32GiBEmptyV1, fixture32GiBEmptyV2}
+	names := make(map[string]struct{})
+	for _, fixture := range fixtures {
+		name := commcid.PieceCIDToFilename(cid.MustParse(fixture))
+		require.Equal(t, name, commcid.PieceCIDToFilename(cid.MustParse(fixture)))
+		require.Equal(t, fixture, filepath.Base(name))
+		require.Equal(t, fixture[len(fixture)-3:len(fixture)-1], filepath.Dir(name))
+		require.True(t, filepath.IsLocal(name))
+		names[name] = struct{}{}
+	}
+	require.Len(t, names, len(fixtures))
+
+	require.Equal(t, filepath.Join("mp", fixture32GiBEmptyV1), commcid.PieceCIDToFilename(cid.MustParse(fixture32GiBEmptyV1)))
+}
@@ -0,0 +1,13 @@
+package commcid
+
+import "crypto/sha256"
+
+// sum256 hashes a pair of merkle nodes. It is the accelerated implementation
+// picked at build time, which falls back to scalarSum256 where no faster one
+// is available.
+var sum256 = acceleratedSum256
+
+// scalarSum256 is the portable standard library sha256
+func scalarSum256(data []byte) [sha256.Size]byte {
+	return sha256.Sum256(data)
+}
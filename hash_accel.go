@@ -0,0 +1,10 @@
+//go:build !commcid_purego
+
+package commcid
+
+import sha256simd "github.com/minio/sha256-simd"
+
+// acceleratedSum256 uses the SHA extensions, AVX512 or ARMv8 SHA2
+// instructions when the CPU supports them, detected at runtime, and the
+// standard library otherwise
+var acceleratedSum256 = sha256simd.Sum256
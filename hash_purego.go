@@ -0,0 +1,7 @@
+//go:build commcid_purego
+
+package commcid
+
+// acceleratedSum256 is the scalar implementation when built with the
+// commcid_purego tag
+var acceleratedSum256 = scalarSum256
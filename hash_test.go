@@ -0,0 +1,48 @@
+package commcid_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceleratedHashingMatchesScalar(t *testing.T) {
+	data := make([]byte, 127<<10+1000)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	accelerated, acceleratedSize, err := commcid.PieceCIDFromReader(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	restore := commcid.UseScalarHashing()
+	defer restore()
+	scalar, scalarSize, err := commcid.PieceCIDFromReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, scalar, accelerated)
+	require.Equal(t, scalarSize, acceleratedSize)
+
+	c, _, err := commcid.PieceCIDFromReader(bytes.NewReader(fixture127OfEach0123))
+	require.NoError(t, err)
+	require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+}
+
+func BenchmarkPieceCIDFromReader(b *testing.B) {
+	data := make([]byte, 8<<20/128*127)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	run := func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			if _, _, err := commcid.PieceCIDFromReader(bytes.NewReader(data)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.Run("accelerated", run)
+	b.Run("scalar", func(b *testing.B) {
+		defer commcid.UseScalarHashing()()
+		run(b)
+	})
+}
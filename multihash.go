@@ -0,0 +1,56 @@
+package commcid
+
+import (
+	"github.com/multiformats/go-multihash"
+	"golang.org/x/xerrors"
+)
+
+// DataCommitmentV1ToMultihash encodes a raw data commitment as a
+// SHA2_256_TRUNC254_PADDED multihash, with the same checks as
+// DataCommitmentV1ToCID
+func DataCommitmentV1ToMultihash(commD []byte) (multihash.Multihash, error) {
+	if err := validateCommitmentLength(commD); err != nil {
+		return nil, err
+	}
+	if err := validateTruncatedDigest(commD); err != nil {
+		return nil, err
+	}
+	return commitmentMultihash(multihash.SHA2_256_TRUNC254_PADDED, commD), nil
+}
+
+// PieceCommitmentV1ToMultihash encodes a commP as a multihash
+// -- it is just a helper function that is equivalent to
+// DataCommitmentV1ToMultihash.
+var PieceCommitmentV1ToMultihash = DataCommitmentV1ToMultihash
+
+// ReplicaCommitmentV1ToMultihash encodes a raw replica commitment as a
+// POSEIDON_BLS12_381_A1_FC1 multihash, with the same checks as
+// ReplicaCommitmentV1ToCID
+func ReplicaCommitmentV1ToMultihash(commR []byte) (multihash.Multihash, error) {
+	if err := validateCommitmentLength(commR); err != nil {
+		return nil, err
+	}
+	if err := validateFieldElement(commR); err != nil {
+		return nil, err
+	}
+	return commitmentMultihash(multihash.POSEIDON_BLS12_381_A1_FC1, commR), nil
+}
+
+// MultihashToCommitment extracts the raw commitment and the multihash code
+// from a data or replica commitment multihash. Any other multihash code,
+// including that of v2 piece CIDs, is rejected with ErrIncorrectHash.
+func MultihashToCommitment(mh multihash.Multihash) ([]byte, uint64, error) {
+	decoded, err := multihash.Decode(mh)
+	if err != nil {
+		return nil, 0, xerrors.Errorf("Error decoding commitment multihash: %w", err)
+	}
+	switch decoded.Code {
+	case multihash.SHA2_256_TRUNC254_PADDED, multihash.POSEIDON_BLS12_381_A1_FC1:
+	default:
+		return nil, 0, ErrIncorrectHash
+	}
+	if err := validateCommitmentLength(decoded.Digest); err != nil {
+		return nil, 0, err
+	}
+	return decoded.Digest, decoded.Code, nil
+}
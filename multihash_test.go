@@ -0,0 +1,68 @@
+package commcid_test
+
+import (
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitmentMultihashRoundTrip(t *testing.T) {
+	commX := testRandomCommitments(t, 1)[0]
+
+	for _, tc := range []struct {
+		name     string
+		toMh     func([]byte) (multihash.Multihash, error)
+		toCID    func([]byte) (cid.Cid, error)
+		hashCode uint64
+	}{
+		{"data", commcid.DataCommitmentV1ToMultihash, commcid.DataCommitmentV1ToCID, multihash.SHA2_256_TRUNC254_PADDED},
+		{"piece", commcid.PieceCommitmentV1ToMultihash, commcid.PieceCommitmentV1ToCID, multihash.SHA2_256_TRUNC254_PADDED},
+		{"replica", commcid.ReplicaCommitmentV1ToMultihash, commcid.ReplicaCommitmentV1ToCID, multihash.POSEIDON_BLS12_381_A1_FC1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mh, err := tc.toMh(commX)
+			require.NoError(t, err)
+			c, err := tc.toCID(commX)
+			require.NoError(t, err)
+			require.Equal(t, c.Hash(), mh)
+
+			commitment, hashCode, err := commcid.MultihashToCommitment(mh)
+			require.NoError(t, err)
+			require.Equal(t, commX, commitment)
+			require.Equal(t, tc.hashCode, hashCode)
+
+			_, err = tc.toMh(commX[:31])
+			require.ErrorIs(t, err, commcid.ErrIncorrectLength)
+		})
+	}
+
+	t.Run("error on invalid commitments", func(t *testing.T) {
+		invalid := append([]byte{}, commX...)
+		invalid[31] = 0xff
+		_, err := commcid.DataCommitmentV1ToMultihash(invalid)
+		require.ErrorIs(t, err, commcid.ErrInvalidTruncatedDigest)
+		_, err = commcid.ReplicaCommitmentV1ToMultihash(invalid)
+		require.ErrorIs(t, err, commcid.ErrInvalidFieldElement)
+	})
+}
+
+func TestMultihashToCommitment(t *testing.T) {
+	commX := testRandomCommitments(t, 1)[0]
+
+	sha, err := multihash.Encode(commX, multihash.SHA2_256)
+	require.NoError(t, err)
+	_, _, err = commcid.MultihashToCommitment(sha)
+	require.ErrorIs(t, err, commcid.ErrIncorrectHash)
+
+	_, _, err = commcid.MultihashToCommitment(cid.MustParse(fixture32GiBEmptyV2).Hash())
+	require.ErrorIs(t, err, commcid.ErrIncorrectHash)
+
+	_, _, err = commcid.MultihashToCommitment(testMultiHash(multihash.SHA2_256_TRUNC254_PADDED, commX, 5))
+	require.Regexp(t, "^Error decoding commitment multihash:", err.Error())
+
+	_, _, err = commcid.MultihashToCommitment(testMultiHash(multihash.SHA2_256_TRUNC254_PADDED, commX[:31], 0))
+	require.EqualError(t, err, "commitments must be 32 bytes long, got 31")
+}
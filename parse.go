@@ -0,0 +1,127 @@
+package commcid
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// ParsePieceCIDFromOutput extracts the first v1 or v2 piece CID found in s,
+// tolerating surrounding text such as a bare CID, a "Piece CID: <cid>" line or
+// a JSON document
+func ParsePieceCIDFromOutput(s string) (cid.Cid, error) {
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+	})
+	for _, w := range words {
+		c, err := cid.Decode(w)
+		if err != nil {
+			continue
+		}
+		if t := Classify(c); t == CommitmentTypeData || t == CommitmentTypePieceV2 {
+			return c, nil
+		}
+	}
+	return cid.Undef, xerrors.New("no piece CID found in output")
+}
+
+// ParseCommitment parses a commitment pasted in any of the forms users have to
+// hand: a data, replica or v2 piece CID string, or a 32 byte commitment in hex
+// with or without a 0x prefix. Surrounding whitespace is ignored.
+//
+// s is first tried as a CID, and only parsed as hex if that fails. A CID must
+// be a commitment CID, and its kind is returned; raw hex carries no kind, so
+// it is returned as CommitmentTypeUnknown.
+func ParseCommitment(s string) ([]byte, Kind, error) {
+	s = strings.TrimSpace(s)
+	if c, err := cid.Decode(s); err == nil {
+		kind := Classify(c)
+		if kind == CommitmentTypeUnknown {
+			return nil, CommitmentTypeUnknown, ErrIncorrectCodec
+		}
+		commX, err := commitmentDigest(c)
+		if err != nil {
+			return nil, CommitmentTypeUnknown, err
+		}
+		return commX, kind, nil
+	}
+
+	commX, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return nil, CommitmentTypeUnknown, xerrors.Errorf("commitment %q is neither a CID nor hex", s)
+	}
+	if err := validateCommitmentLength(commX); err != nil {
+		return nil, CommitmentTypeUnknown, err
+	}
+	return commX, CommitmentTypeUnknown, nil
+}
+
+// IsCanonicalEncoding reports whether s is a commitment CID written in its
+// canonical form, the lowercase base32 multibase that CIDs default to. It
+// errors if s is not a commitment CID at all.
+func IsCanonicalEncoding(s string) (bool, error) {
+	c, err := cid.Decode(s)
+	if err != nil {
+		return false, xerrors.Errorf("Error decoding commitment CID: %w", err)
+	}
+	if Classify(c) == CommitmentTypeUnknown {
+		return false, ErrIncorrectCodec
+	}
+	return s == c.String(), nil
+}
+
+// ParseLegacyCommitmentRef converts a pre-CID commitment reference of the form
+// fil/unsealed/<hex> or fil/sealed/<hex> into a commitment CID. A leading
+// slash and a fil/1/ version segment are accepted.
+func ParseLegacyCommitmentRef(s string) (cid.Cid, CommitmentType, error) {
+	ref := strings.TrimPrefix(s, "/")
+	ref, ok := strings.CutPrefix(ref, "fil/")
+	if !ok {
+		return cid.Undef, CommitmentTypeUnknown, xerrors.Errorf("unrecognized legacy commitment reference %q", s)
+	}
+	ref = strings.TrimPrefix(ref, "1/")
+
+	var t CommitmentType
+	var toCID func([]byte) (cid.Cid, error)
+	switch kind, commHex, _ := strings.Cut(ref, "/"); kind {
+	case "unsealed":
+		t, toCID, ref = CommitmentTypeData, DataCommitmentV1ToCID, commHex
+	case "sealed":
+		t, toCID, ref = CommitmentTypeReplica, ReplicaCommitmentV1ToCID, commHex
+	default:
+		return cid.Undef, CommitmentTypeUnknown, xerrors.Errorf("unrecognized legacy commitment reference %q", s)
+	}
+
+	commX, err := hex.DecodeString(ref)
+	if err != nil {
+		return cid.Undef, CommitmentTypeUnknown, xerrors.Errorf("Error decoding legacy commitment: %w", err)
+	}
+	c, err := toCID(commX)
+	if err != nil {
+		return cid.Undef, CommitmentTypeUnknown, err
+	}
+	return c, t, nil
+}
+
+// CanonicalizePieceCIDStrings parses each of the given commitment CID strings
+// and re-encodes it in canonical base32. The results keep the input order:
+// out[i] and errs[i] describe in[i], with out[i] empty whenever errs[i] is set.
+func CanonicalizePieceCIDStrings(in []string) ([]string, []error) {
+	out := make([]string, len(in))
+	errs := make([]error, len(in))
+	for i, s := range in {
+		c, err := cid.Decode(strings.TrimSpace(s))
+		if err != nil {
+			errs[i] = xerrors.Errorf("row %d: Error decoding commitment CID: %w", i, err)
+			continue
+		}
+		if Classify(c) == CommitmentTypeUnknown {
+			errs[i] = xerrors.Errorf("row %d: %w", i, ErrIncorrectCodec)
+			continue
+		}
+		out[i] = c.String()
+	}
+	return out, errs
+}
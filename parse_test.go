@@ -0,0 +1,168 @@
+package commcid_test
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multibase"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePieceCIDFromOutput(t *testing.T) {
+	for _, output := range []string{
+		fixture127OfEach0123PieceCID,
+		fixture127OfEach0123PieceCID + "\n",
+		"Piece CID: " + fixture127OfEach0123PieceCID,
+		"Piece size: 512\nPiece CID: " + fixture127OfEach0123PieceCID + "\n",
+		`{"PieceCID":{"/":"` + fixture127OfEach0123PieceCID + `"},"Size":512}`,
+	} {
+		c, err := commcid.ParsePieceCIDFromOutput(output)
+		require.NoError(t, err, output)
+		require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+	}
+
+	c, err := commcid.ParsePieceCIDFromOutput("Piece CID: " + fixture32GiBEmptyV2)
+	require.NoError(t, err)
+	require.Equal(t, fixture32GiBEmptyV2, c.String())
+
+	t.Run("skips non-piece CIDs", func(t *testing.T) {
+		c, err := commcid.ParsePieceCIDFromOutput("Root: bafkqaaa Piece CID: " + fixture127OfEach0123PieceCID)
+		require.NoError(t, err)
+		require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+	})
+
+	t.Run("error when no piece CID is present", func(t *testing.T) {
+		_, err := commcid.ParsePieceCIDFromOutput("Piece CID: <none>")
+		require.EqualError(t, err, "no piece CID found in output")
+	})
+}
+
+func TestParseCommitment(t *testing.T) {
+	expected, err := hex.DecodeString(fixture32GiBEmptyHex)
+	require.NoError(t, err)
+	commR := make([]byte, 32)
+	commR[0] = 0xab
+	replicaCid, err := commcid.ReplicaCommitmentV1ToCID(commR)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		input  string
+		digest []byte
+		kind   commcid.Kind
+	}{
+		{fixture32GiBEmptyV1, expected, commcid.CommitmentTypeData},
+		{fixture32GiBEmptyV2, expected, commcid.CommitmentTypePieceV2},
+		{replicaCid.String(), commR, commcid.CommitmentTypeReplica},
+		{cid.MustParse(fixture32GiBEmptyV1).Encode(multibase.MustNewEncoder(multibase.Base16)), expected, commcid.CommitmentTypeData},
+		{fixture32GiBEmptyHex, expected, commcid.CommitmentTypeUnknown},
+		{"0x" + fixture32GiBEmptyHex, expected, commcid.CommitmentTypeUnknown},
+		{"  " + strings.ToUpper(fixture32GiBEmptyHex) + "\n", expected, commcid.CommitmentTypeUnknown},
+	} {
+		digest, kind, err := commcid.ParseCommitment(tc.input)
+		require.NoError(t, err, tc.input)
+		require.Equal(t, tc.digest, digest, tc.input)
+		require.Equal(t, tc.kind, kind, tc.input)
+	}
+
+	t.Run("error on non-commitment CID", func(t *testing.T) {
+		_, _, err := commcid.ParseCommitment("bafkqaaa")
+		require.ErrorIs(t, err, commcid.ErrIncorrectCodec)
+	})
+
+	t.Run("error on wrong length hex", func(t *testing.T) {
+		_, _, err := commcid.ParseCommitment("0x0011")
+		require.ErrorIs(t, err, commcid.ErrIncorrectLength)
+	})
+
+	t.Run("error on anything else", func(t *testing.T) {
+		_, _, err := commcid.ParseCommitment("not a commitment")
+		require.EqualError(t, err, `commitment "not a commitment" is neither a CID nor hex`)
+	})
+}
+
+func TestIsCanonicalEncoding(t *testing.T) {
+	canonical, err := commcid.IsCanonicalEncoding(fixture127OfEach0123PieceCID)
+	require.NoError(t, err)
+	require.True(t, canonical)
+
+	canonical, err = commcid.IsCanonicalEncoding(fixture32GiBEmptyV2)
+	require.NoError(t, err)
+	require.True(t, canonical)
+
+	base16, err := cid.MustParse(fixture127OfEach0123PieceCID).StringOfBase(multibase.Base16)
+	require.NoError(t, err)
+	canonical, err = commcid.IsCanonicalEncoding(base16)
+	require.NoError(t, err)
+	require.False(t, canonical)
+
+	t.Run("error on non-commitment CID", func(t *testing.T) {
+		_, err := commcid.IsCanonicalEncoding("bafkqaaa")
+		require.ErrorIs(t, err, commcid.ErrIncorrectCodec)
+	})
+
+	t.Run("error on invalid CID", func(t *testing.T) {
+		_, err := commcid.IsCanonicalEncoding("not a cid")
+		require.ErrorContains(t, err, "Error decoding commitment CID")
+	})
+}
+
+func TestParseLegacyCommitmentRef(t *testing.T) {
+	for _, ref := range []string{
+		"fil/unsealed/" + fixture32GiBEmptyHex,
+		"/fil/unsealed/" + fixture32GiBEmptyHex,
+		"/fil/1/unsealed/" + fixture32GiBEmptyHex,
+	} {
+		c, commType, err := commcid.ParseLegacyCommitmentRef(ref)
+		require.NoError(t, err, ref)
+		require.Equal(t, commcid.CommitmentTypeData, commType)
+		require.Equal(t, fixture32GiBEmptyV1, c.String())
+	}
+
+	c, commType, err := commcid.ParseLegacyCommitmentRef("fil/sealed/" + fixture32GiBEmptyHex)
+	require.NoError(t, err)
+	require.Equal(t, commcid.CommitmentTypeReplica, commType)
+	require.NoError(t, commcid.ExpectCommitmentHex(c, fixture32GiBEmptyHex))
+	require.Equal(t, commcid.CommitmentTypeReplica, commcid.Classify(c))
+
+	t.Run("error on unrecognized format", func(t *testing.T) {
+		for _, ref := range []string{
+			fixture32GiBEmptyHex,
+			"fil/piece/" + fixture32GiBEmptyHex,
+			"ipfs/unsealed/" + fixture32GiBEmptyHex,
+		} {
+			_, _, err := commcid.ParseLegacyCommitmentRef(ref)
+			require.EqualError(t, err, "unrecognized legacy commitment reference \""+ref+"\"")
+		}
+	})
+
+	t.Run("error on invalid commitment", func(t *testing.T) {
+		_, _, err := commcid.ParseLegacyCommitmentRef("fil/unsealed/zz")
+		require.ErrorContains(t, err, "Error decoding legacy commitment")
+
+		_, _, err = commcid.ParseLegacyCommitmentRef("fil/unsealed/0011")
+		require.EqualError(t, err, "commitments must be 32 bytes long, got 2")
+	})
+}
+
+func TestCanonicalizePieceCIDStrings(t *testing.T) {
+	base16, err := cid.MustParse(fixture127OfEach0123PieceCID).StringOfBase(multibase.Base16)
+	require.NoError(t, err)
+
+	out, errs := commcid.CanonicalizePieceCIDStrings([]string{
+		fixture127OfEach0123PieceCID,
+		base16,
+		"not a cid",
+		" " + fixture32GiBEmptyV2 + " ",
+		"bafkqaaa",
+	})
+	require.Equal(t, []string{fixture127OfEach0123PieceCID, fixture127OfEach0123PieceCID, "", fixture32GiBEmptyV2, ""}, out)
+	require.Len(t, errs, 5)
+	require.NoError(t, errs[0])
+	require.NoError(t, errs[1])
+	require.ErrorContains(t, errs[2], "row 2: Error decoding commitment CID")
+	require.NoError(t, errs[3])
+	require.ErrorIs(t, errs[4], commcid.ErrIncorrectCodec)
+}
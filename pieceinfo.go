@@ -0,0 +1,181 @@
+package commcid
+
+import (
+	"encoding/json"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"golang.org/x/xerrors"
+)
+
+// PieceInfo describes a piece by its v1 or v2 piece CID and padded size
+type PieceInfo struct {
+	PieceCID cid.Cid
+	Size     uint64
+}
+
+// Validate returns an error unless the piece CID is a v1 or v2 piece CID and
+// the size is a valid padded piece size matching any size the CID encodes
+func (p PieceInfo) Validate() error {
+	return validatePieceSize(p.PieceCID, p.Size)
+}
+
+// PieceInfoV2 describes a piece by its v2 piece CID and unpadded size. It
+// marshals to JSON as {"pieceCid": "...", "unpaddedSize": N}.
+type PieceInfoV2 struct {
+	PieceCID     cid.Cid
+	UnpaddedSize uint64
+}
+
+// pieceInfoV2JSON is the JSON form of PieceInfoV2
+type pieceInfoV2JSON struct {
+	PieceCID     string `json:"pieceCid"`
+	UnpaddedSize uint64 `json:"unpaddedSize"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (p PieceInfoV2) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pieceInfoV2JSON{PieceCID: p.PieceCID.String(), UnpaddedSize: p.UnpaddedSize})
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It returns an error unless the
+// CID is a v2 piece CID encoding the same unpadded size as the record.
+func (p *PieceInfoV2) UnmarshalJSON(data []byte) error {
+	var raw pieceInfoV2JSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	c, err := cid.Decode(raw.PieceCID)
+	if err != nil {
+		return xerrors.Errorf("Error decoding piece CID: %w", err)
+	}
+	_, encoded, err := PieceMhCIDToDataCommitmentV1(c)
+	if err != nil {
+		return err
+	}
+	if encoded != raw.UnpaddedSize {
+		return xerrors.Errorf("unpadded size %d does not match the size %d encoded in piece CID", raw.UnpaddedSize, encoded)
+	}
+	*p = PieceInfoV2{PieceCID: c, UnpaddedSize: encoded}
+	return nil
+}
+
+// PieceSizeHistogram counts how many of the given pieces have each padded size
+func PieceSizeHistogram(pieces []PieceInfo) (map[uint64]int, error) {
+	histogram := make(map[uint64]int)
+	for i, p := range pieces {
+		if err := p.Validate(); err != nil {
+			return nil, xerrors.Errorf("piece %d: %w", i, err)
+		}
+		histogram[p.Size]++
+	}
+	return histogram, nil
+}
+
+// TotalPaddedSize returns the sum of the padded sizes of the given pieces,
+// failing with ErrSizeOverflow if it does not fit in a uint64
+func TotalPaddedSize(pieces []PieceInfo) (uint64, error) {
+	var total uint64
+	for i, p := range pieces {
+		if err := p.Validate(); err != nil {
+			return 0, xerrors.Errorf("piece %d: %w", i, err)
+		}
+		if total > math.MaxUint64-p.Size {
+			return 0, xerrors.Errorf("adding piece %d: %w", i, ErrSizeOverflow)
+		}
+		total += p.Size
+	}
+	return total, nil
+}
+
+// AggregateDealKey returns a deterministic dag-cbor CID identifying a set of
+// pieces: the sha256 of a dag-cbor list linking to every piece CID, sorted by
+// their binary encoding so the key does not depend on input order
+func AggregateDealKey(pieces []PieceInfo) (cid.Cid, error) {
+	if len(pieces) == 0 {
+		return cid.Undef, xerrors.New("no pieces given")
+	}
+	pieceCids := make([]cid.Cid, len(pieces))
+	for i, p := range pieces {
+		if err := p.Validate(); err != nil {
+			return cid.Undef, xerrors.Errorf("piece %d: %w", i, err)
+		}
+		pieceCids[i] = p.PieceCID
+	}
+	slices.SortFunc(pieceCids, func(a, b cid.Cid) int {
+		return strings.Compare(a.KeyString(), b.KeyString())
+	})
+
+	node := appendCborHeader(nil, cborMajorArray, uint64(len(pieceCids)))
+	for _, c := range pieceCids {
+		node = appendCborLink(node, c)
+	}
+	mh, err := multihash.Sum(node, multihash.SHA2_256, -1)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return cid.NewCidV1(cid.DagCBOR, mh), nil
+}
+
+// ArePiecesAdjacent reports whether sub-piece b immediately follows sub-piece a
+// within aggregate, given the padded offset of each. Both offsets must be
+// aligned to the size of their piece, and when the aggregate is a v2 piece CID
+// both pieces must lie within its padded size.
+func ArePiecesAdjacent(aggregate cid.Cid, a, b PieceInfo, offsetA, offsetB uint64) (bool, error) {
+	aggregateSize := uint64(math.MaxUint64)
+	switch Classify(aggregate) {
+	case CommitmentTypeData:
+	case CommitmentTypePieceV2:
+		size, _, _, err := AccountingInfo(aggregate)
+		if err != nil {
+			return false, err
+		}
+		aggregateSize = size
+	default:
+		return false, ErrIncorrectCodec
+	}
+
+	for _, sub := range []struct {
+		name   string
+		piece  PieceInfo
+		offset uint64
+	}{{"a", a, offsetA}, {"b", b, offsetB}} {
+		if err := sub.piece.Validate(); err != nil {
+			return false, xerrors.Errorf("piece %s: %w", sub.name, err)
+		}
+		if sub.offset%sub.piece.Size != 0 {
+			return false, xerrors.Errorf("piece %s offset %d is not aligned to its size %d", sub.name, sub.offset, sub.piece.Size)
+		}
+		if sub.offset > aggregateSize-sub.piece.Size {
+			return false, xerrors.Errorf("piece %s at offset %d extends past the end of the aggregate", sub.name, sub.offset)
+		}
+	}
+
+	return offsetA+a.Size == offsetB, nil
+}
+
+// validatePieceSize checks that c is a v1 or v2 piece CID and that paddedSize
+// is a valid padded piece size agreeing with any size the CID encodes
+func validatePieceSize(c cid.Cid, paddedSize uint64) error {
+	if err := validatePaddedSize(paddedSize); err != nil {
+		return err
+	}
+	switch Classify(c) {
+	case CommitmentTypeData:
+		return nil
+	case CommitmentTypePieceV2:
+		encoded, _, _, err := AccountingInfo(c)
+		if err != nil {
+			return err
+		}
+		if encoded != paddedSize {
+			return xerrors.Errorf("padded size %d does not match the size %d encoded in piece CID", paddedSize, encoded)
+		}
+		return nil
+	default:
+		return ErrIncorrectCodec
+	}
+}
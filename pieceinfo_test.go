@@ -0,0 +1,160 @@
+package commcid_test
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPieceSizeHistogram(t *testing.T) {
+	randBytes := make([]byte, 32)
+	_, err := rand.Read(randBytes)
+	require.NoError(t, err)
+	randBytes[31] &= 0x3f
+	small, err := commcid.DataCommitmentV1ToPieceMhCID(randBytes, 1000)
+	require.NoError(t, err)
+
+	pieces := []commcid.PieceInfo{
+		{PieceCID: cid.MustParse(fixture127OfEach0123PieceCID), Size: 512},
+		{PieceCID: cid.MustParse(fixture32GiBEmptyV1), Size: 32 << 30},
+		{PieceCID: cid.MustParse(fixture32GiBEmptyV2), Size: 32 << 30},
+		{PieceCID: small, Size: 1024},
+		{PieceCID: cid.MustParse(fixture127OfEach0123PieceCID), Size: 512},
+	}
+	histogram, err := commcid.PieceSizeHistogram(pieces)
+	require.NoError(t, err)
+	require.Equal(t, map[uint64]int{512: 2, 1024: 1, 32 << 30: 2}, histogram)
+
+	t.Run("error on invalid piece", func(t *testing.T) {
+		pieces := append(pieces, commcid.PieceInfo{PieceCID: small, Size: 2048})
+		_, err := commcid.PieceSizeHistogram(pieces)
+		require.EqualError(t, err, "piece 5: padded size 2048 does not match the size 1024 encoded in piece CID")
+	})
+}
+
+func TestArePiecesAdjacent(t *testing.T) {
+	aggregate := cid.MustParse(fixture32GiBEmptyV2)
+	piece := commcid.PieceInfo{PieceCID: cid.MustParse(fixture127OfEach0123PieceCID), Size: 512}
+
+	adjacent, err := commcid.ArePiecesAdjacent(aggregate, piece, piece, 0, 512)
+	require.NoError(t, err)
+	require.True(t, adjacent)
+
+	adjacent, err = commcid.ArePiecesAdjacent(aggregate, piece, piece, 0, 1024)
+	require.NoError(t, err)
+	require.False(t, adjacent)
+
+	adjacent, err = commcid.ArePiecesAdjacent(aggregate, piece, piece, 512, 0)
+	require.NoError(t, err)
+	require.False(t, adjacent)
+
+	t.Run("error on unaligned offset", func(t *testing.T) {
+		large := commcid.PieceInfo{PieceCID: cid.MustParse(fixture127OfEach0123PieceCID), Size: 1024}
+		_, err := commcid.ArePiecesAdjacent(aggregate, piece, large, 0, 512)
+		require.EqualError(t, err, "piece b offset 512 is not aligned to its size 1024")
+	})
+
+	t.Run("error on piece past the end of the aggregate", func(t *testing.T) {
+		randBytes := make([]byte, 32)
+		_, err := rand.Read(randBytes)
+		require.NoError(t, err)
+		randBytes[31] &= 0x3f
+		small, err := commcid.DataCommitmentV1ToPieceMhCID(randBytes, 1000)
+		require.NoError(t, err)
+
+		_, err = commcid.ArePiecesAdjacent(small, piece, piece, 512, 1024)
+		require.EqualError(t, err, "piece b at offset 1024 extends past the end of the aggregate")
+	})
+
+	t.Run("error on non-piece aggregate", func(t *testing.T) {
+		sealed, err := commcid.ReplicaCommitmentV1ToCID(make([]byte, 32))
+		require.NoError(t, err)
+		_, err = commcid.ArePiecesAdjacent(sealed, piece, piece, 0, 512)
+		require.ErrorIs(t, err, commcid.ErrIncorrectCodec)
+	})
+}
+
+func TestAggregateDealKey(t *testing.T) {
+	pieces := []commcid.PieceInfo{
+		{PieceCID: cid.MustParse(fixture127OfEach0123PieceCID), Size: 512},
+		{PieceCID: cid.MustParse(fixture32GiBEmptyV1), Size: 32 << 30},
+		{PieceCID: cid.MustParse(fixture32GiBEmptyV2), Size: 32 << 30},
+	}
+	key, err := commcid.AggregateDealKey(pieces)
+	require.NoError(t, err)
+	require.Equal(t, uint64(cid.DagCBOR), key.Prefix().Codec)
+	require.Equal(t, uint64(multihash.SHA2_256), key.Prefix().MhType)
+
+	reordered, err := commcid.AggregateDealKey([]commcid.PieceInfo{pieces[2], pieces[0], pieces[1]})
+	require.NoError(t, err)
+	require.Equal(t, key, reordered)
+
+	subset, err := commcid.AggregateDealKey(pieces[:2])
+	require.NoError(t, err)
+	require.NotEqual(t, key, subset)
+
+	t.Run("error on invalid piece", func(t *testing.T) {
+		_, err := commcid.AggregateDealKey([]commcid.PieceInfo{pieces[0], {PieceCID: pieces[1].PieceCID, Size: 1000}})
+		require.ErrorContains(t, err, "piece 1: ")
+	})
+
+	t.Run("error on no pieces", func(t *testing.T) {
+		_, err := commcid.AggregateDealKey(nil)
+		require.EqualError(t, err, "no pieces given")
+	})
+}
+
+func TestTotalPaddedSize(t *testing.T) {
+	pieces := []commcid.PieceInfo{
+		{PieceCID: cid.MustParse(fixture127OfEach0123PieceCID), Size: 512},
+		{PieceCID: cid.MustParse(fixture32GiBEmptyV1), Size: 32 << 30},
+		{PieceCID: cid.MustParse(fixture32GiBEmptyV2), Size: 32 << 30},
+	}
+	total, err := commcid.TotalPaddedSize(pieces)
+	require.NoError(t, err)
+	require.Equal(t, uint64(64<<30+512), total)
+
+	total, err = commcid.TotalPaddedSize(nil)
+	require.NoError(t, err)
+	require.Zero(t, total)
+
+	t.Run("error on overflow", func(t *testing.T) {
+		huge := commcid.PieceInfo{PieceCID: cid.MustParse(fixture127OfEach0123PieceCID), Size: 1 << 63}
+		_, err := commcid.TotalPaddedSize([]commcid.PieceInfo{pieces[0], huge, huge})
+		require.ErrorIs(t, err, commcid.ErrSizeOverflow)
+		require.EqualError(t, err, "adding piece 2: size overflows uint64")
+	})
+
+	t.Run("error on invalid piece", func(t *testing.T) {
+		_, err := commcid.TotalPaddedSize([]commcid.PieceInfo{pieces[0], {PieceCID: pieces[2].PieceCID, Size: 512}})
+		require.EqualError(t, err, "piece 1: padded size 512 does not match the size 34359738368 encoded in piece CID")
+	})
+}
+
+func TestPieceInfoV2JSON(t *testing.T) {
+	p := commcid.PieceInfoV2{PieceCID: cid.MustParse(fixture32GiBEmptyV2), UnpaddedSize: fixture32GiBUnpadded}
+	encoded, err := json.Marshal(p)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"pieceCid":"`+fixture32GiBEmptyV2+`","unpaddedSize":34091302912}`, string(encoded))
+
+	var decoded commcid.PieceInfoV2
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	require.Equal(t, p, decoded)
+
+	t.Run("error on size mismatch", func(t *testing.T) {
+		var decoded commcid.PieceInfoV2
+		err := json.Unmarshal([]byte(`{"pieceCid":"`+fixture32GiBEmptyV2+`","unpaddedSize":1000}`), &decoded)
+		require.EqualError(t, err, "unpadded size 1000 does not match the size 34091302912 encoded in piece CID")
+	})
+
+	t.Run("error on v1 piece CID", func(t *testing.T) {
+		var decoded commcid.PieceInfoV2
+		err := json.Unmarshal([]byte(`{"pieceCid":"`+fixture32GiBEmptyV1+`","unpaddedSize":1000}`), &decoded)
+		require.ErrorIs(t, err, commcid.ErrIncorrectHash)
+	})
+}
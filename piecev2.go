@@ -0,0 +1,367 @@
+package commcid
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/multiformats/go-varint"
+	"golang.org/x/xerrors"
+)
+
+// FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE is the multihash code used by
+// v2 piece CIDs (FRC-0069). Its digest is the uvarint encoded padding, a
+// single tree height byte and the 32 byte data commitment.
+const FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE = 0x1011
+
+// DataCommitmentV1ToPieceMhCID converts a raw data commitment and the size of
+// the unpadded data it commits to into a v2 piece CID
+// by adding:
+// - codec: cid.Raw
+// - hash type: FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE
+// It returns ErrInvalidTruncatedDigest if the top two bits of the commitment
+// are set.
+func DataCommitmentV1ToPieceMhCID(commD []byte, unpaddedDataSize uint64) (cid.Cid, error) {
+	if err := validateCommitmentLength(commD); err != nil {
+		return cid.Undef, err
+	}
+	if err := validateTruncatedDigest(commD); err != nil {
+		return cid.Undef, err
+	}
+
+	height, padding, err := UnpaddedSizeToV1TreeHeightAndPadding(unpaddedDataSize)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	digestSize := varint.UvarintSize(padding) + 1 + len(commD)
+	mhBuf := make(
+		[]byte,
+		varint.UvarintSize(FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE)+varint.UvarintSize(uint64(digestSize))+digestSize,
+	)
+
+	pos := varint.PutUvarint(mhBuf, FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE)
+	pos += varint.PutUvarint(mhBuf[pos:], uint64(digestSize))
+	pos += varint.PutUvarint(mhBuf[pos:], padding)
+	mhBuf[pos] = height
+	copy(mhBuf[pos+1:], commD)
+
+	return cid.NewCidV1(cid.Raw, multihash.Multihash(mhBuf)), nil
+}
+
+// DataCommitmentV1ToPieceMhCIDFromPadded converts a raw data commitment and
+// its padded piece size into a v2 piece CID. The padded size only fixes the
+// tree height, so the piece is encoded as filling its tree, with zero padding.
+func DataCommitmentV1ToPieceMhCIDFromPadded(commD []byte, paddedSize uint64) (cid.Cid, error) {
+	if err := validatePaddedSize(paddedSize); err != nil {
+		return cid.Undef, err
+	}
+	return DataCommitmentV1ToPieceMhCID(commD, paddedSize/fr32PaddedChunk*fr32UnpaddedChunk)
+}
+
+// PieceMhCIDToDataCommitmentV1 extracts the raw data commitment and the size of
+// the unpadded data from a v2 piece CID, after checking for the correct codec
+// and hash type
+func PieceMhCIDToDataCommitmentV1(c cid.Cid) ([]byte, uint64, error) {
+	digest, height, padding, err := decodePieceMhCID(c)
+	if err != nil {
+		return nil, 0, err
+	}
+	return digest, unpaddedCapacity(height) - padding, nil
+}
+
+// PieceMhCIDToUnpaddedSize returns the size of the unpadded data a v2 piece
+// CID commits to, validating it as PieceMhCIDToDataCommitmentV1 does but
+// without decoding or copying the commitment
+func PieceMhCIDToUnpaddedSize(c cid.Cid) (uint64, error) {
+	height, padding, err := pieceMhCIDHeightAndPadding(c)
+	if err != nil {
+		return 0, err
+	}
+	return unpaddedCapacity(height) - padding, nil
+}
+
+// PieceMhCIDToTreeHeightAndPadding returns the tree height and padding encoded
+// in a v2 piece CID, validating it as PieceMhCIDToDataCommitmentV1 does
+func PieceMhCIDToTreeHeightAndPadding(c cid.Cid) (height uint8, padding uint64, err error) {
+	return pieceMhCIDHeightAndPadding(c)
+}
+
+// pieceMhCIDHeightAndPadding reads the tree height and padding of a v2 piece
+// CID straight from its binary form. Anything it cannot accept is handed to
+// decodePieceMhCID, so errors match the full decoder.
+func pieceMhCIDHeightAndPadding(c cid.Cid) (uint8, uint64, error) {
+	if height, padding, ok := parsePieceMhCIDHeader(c); ok {
+		return height, padding, nil
+	}
+	_, height, padding, err := decodePieceMhCID(c)
+	return height, padding, err
+}
+
+// parsePieceMhCIDHeader is the allocation free part of
+// pieceMhCIDHeightAndPadding, reporting ok only for a valid v2 piece CID
+func parsePieceMhCIDHeader(c cid.Cid) (uint8, uint64, bool) {
+	codec, hashCode, digestLen, ok := commitmentHeader(c)
+	if !ok || codec != cid.Raw || hashCode != FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE {
+		return 0, 0, false
+	}
+	s := c.KeyString()
+	digest := s[len(s)-digestLen:]
+	padding, n := uvarintFromString(digest)
+	minimal := n == 1 || (n > 1 && digest[n-1] != 0)
+	if !minimal || len(digest) != n+1+nodeSize {
+		return 0, 0, false
+	}
+	height := digest[n]
+	if height < 2 || height > maxTreeHeight || padding >= unpaddedCapacity(height) {
+		return 0, 0, false
+	}
+	if digest[len(digest)-1]&0xc0 != 0 {
+		return 0, 0, false
+	}
+	return height, padding, true
+}
+
+// PieceCIDV2 is a v2 piece CID that has already been validated, giving direct
+// access to the fields packed into its multihash digest
+type PieceCIDV2 struct {
+	c       cid.Cid
+	digest  []byte
+	height  uint8
+	padding uint64
+}
+
+// NewPieceCIDV2 validates c as a v2 piece CID and wraps it
+func NewPieceCIDV2(c cid.Cid) (PieceCIDV2, error) {
+	digest, height, padding, err := decodePieceMhCID(c)
+	if err != nil {
+		return PieceCIDV2{}, err
+	}
+	return PieceCIDV2{c: c, digest: digest, height: height, padding: padding}, nil
+}
+
+// CID returns the wrapped CID
+func (p PieceCIDV2) CID() cid.Cid {
+	return p.c
+}
+
+// Digest returns a copy of the 32 byte data commitment
+func (p PieceCIDV2) Digest() []byte {
+	return bytes.Clone(p.digest)
+}
+
+// TreeHeight returns the height of the piece's merkle tree
+func (p PieceCIDV2) TreeHeight() uint8 {
+	return p.height
+}
+
+// PaddingSize returns how many bytes of zero padding follow the data in the
+// unpadded piece
+func (p PieceCIDV2) PaddingSize() uint64 {
+	return p.padding
+}
+
+// UnpaddedSize returns the size of the unpadded data the piece commits to
+func (p PieceCIDV2) UnpaddedSize() uint64 {
+	return unpaddedCapacity(p.height) - p.padding
+}
+
+// PaddedSize returns the padded piece size
+func (p PieceCIDV2) PaddedSize() uint64 {
+	return nodeSize << p.height
+}
+
+// decodePieceMhCID splits a v2 piece CID into its commitment, tree height and
+// padding
+func decodePieceMhCID(c cid.Cid) ([]byte, uint8, uint64, error) {
+	decoded, err := multihash.Decode([]byte(c.Hash()))
+	if err != nil {
+		return nil, 0, 0, &DecodeError{CID: c, Stage: "data commitment hash", Err: err}
+	}
+
+	if decoded.Code != FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE {
+		return nil, 0, 0, ErrIncorrectHash
+	}
+	if c.Type() != cid.Raw {
+		return nil, 0, 0, ErrIncorrectCodec
+	}
+
+	padding, n, err := varint.FromUvarint(decoded.Digest)
+	if err != nil {
+		return nil, 0, 0, &DecodeError{CID: c, Stage: "piece padding", Err: err}
+	}
+	if len(decoded.Digest) != n+1+32 {
+		return nil, 0, 0, ErrInvalidPieceDigest
+	}
+
+	height := decoded.Digest[n]
+	if height < 2 || height > maxTreeHeight {
+		return nil, 0, 0, fmt.Errorf("%w, got %d", ErrInvalidTreeHeight, height)
+	}
+	if padding >= unpaddedCapacity(height) {
+		return nil, 0, 0, fmt.Errorf("%w, got %d for capacity %d", ErrPaddingExceedsCapacity, padding, unpaddedCapacity(height))
+	}
+	if err := validateTruncatedDigest(decoded.Digest[n+1:]); err != nil {
+		return nil, 0, 0, err
+	}
+
+	return decoded.Digest[n+1:], height, padding, nil
+}
+
+// ValidatePieceCIDV2 returns an error unless c is a well formed v2 piece CID.
+// Each failure has its own error: ErrIncorrectHash or ErrIncorrectCodec for
+// the wrong multihash or codec, a *DecodeError for an undecodable multihash or
+// padding varint, ErrInvalidPieceDigest for a digest of the wrong length,
+// ErrInvalidTreeHeight for a height outside 2 to 58 and
+// ErrPaddingExceedsCapacity for padding of at least the capacity of the tree
+// and ErrInvalidTruncatedDigest for a commitment with its top two bits set.
+func ValidatePieceCIDV2(c cid.Cid) error {
+	_, _, _, err := decodePieceMhCID(c)
+	return err
+}
+
+// AccountingInfo returns the padded piece size of a v2 piece CID together with
+// its usable unpadded capacity and the bytes lost to FR32 expansion. The
+// padded size is always the sum of the other two.
+func AccountingInfo(c cid.Cid) (uint64, uint64, uint64, error) {
+	_, height, _, err := decodePieceMhCID(c)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	paddedSize := uint64(nodeSize) << height
+	capacity := unpaddedCapacity(height)
+	return paddedSize, capacity, paddedSize - capacity, nil
+}
+
+// ConvertDataCommitmentV1V1CIDtoPieceMhCID converts a v1 piece CID and the size
+// of the unpadded data it commits to into a v2 piece CID
+func ConvertDataCommitmentV1V1CIDtoPieceMhCID(v1PieceCid cid.Cid, unpaddedDataSize uint64) (cid.Cid, error) {
+	commD, err := CIDToPieceCommitmentV1(v1PieceCid)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return DataCommitmentV1ToPieceMhCID(commD, unpaddedDataSize)
+}
+
+// ConvertDataCommitmentV1V1CIDtoPieceMhCIDWithPaddedSize converts a v1 piece
+// CID and its padded piece size into a v2 piece CID. The padded size fixes
+// only the tree height, not how much of it holds data, so the piece is taken
+// to fill its tree with no padding. The result matches the v2 CID of the
+// original data only if that data was exactly the tree's unpadded capacity.
+func ConvertDataCommitmentV1V1CIDtoPieceMhCIDWithPaddedSize(v1PieceCid cid.Cid, paddedSize uint64) (cid.Cid, error) {
+	commD, err := CIDToPieceCommitmentV1(v1PieceCid)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return DataCommitmentV1ToPieceMhCIDFromPadded(commD, paddedSize)
+}
+
+// ConvertDataCommitmentV1PieceMhCIDToV1CID converts a v2 piece CID into a v1
+// piece CID and the size of the unpadded data it commits to
+func ConvertDataCommitmentV1PieceMhCIDToV1CID(pieceMhCid cid.Cid) (cid.Cid, uint64, error) {
+	commD, unpaddedDataSize, err := PieceMhCIDToDataCommitmentV1(pieceMhCid)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	v1, err := PieceCommitmentV1ToCID(commD)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	return v1, unpaddedDataSize, nil
+}
+
+// ValidatePieceCIDConsistency converts a piece CID to its other version and
+// back, returning an error unless the result is identical to the input. For a
+// v1 piece CID unpaddedDataSize supplies the size it lacks; for a v2 piece CID
+// it is ignored.
+func ValidatePieceCIDConsistency(c cid.Cid, unpaddedDataSize uint64) error {
+	var roundTripped cid.Cid
+	switch Classify(c) {
+	case CommitmentTypeData:
+		v2, err := ConvertDataCommitmentV1V1CIDtoPieceMhCID(c, unpaddedDataSize)
+		if err != nil {
+			return err
+		}
+		v1, size, err := ConvertDataCommitmentV1PieceMhCIDToV1CID(v2)
+		if err != nil {
+			return err
+		}
+		if size != unpaddedDataSize {
+			return xerrors.Errorf("size changed from %d to %d in conversion", unpaddedDataSize, size)
+		}
+		roundTripped = v1
+	case CommitmentTypePieceV2:
+		v1, size, err := ConvertDataCommitmentV1PieceMhCIDToV1CID(c)
+		if err != nil {
+			return err
+		}
+		v2, err := ConvertDataCommitmentV1V1CIDtoPieceMhCID(v1, size)
+		if err != nil {
+			return err
+		}
+		roundTripped = v2
+	default:
+		return ErrIncorrectCodec
+	}
+
+	if !roundTripped.Equals(c) {
+		return xerrors.Errorf("piece CID %s converted back to %s", c, roundTripped)
+	}
+	return nil
+}
+
+// VerifyPieceCIDV2 returns an error unless c is exactly the v2 piece CID of
+// the data commitment digest over unpaddedSize bytes. The full CID bytes are
+// compared, so a wrong padding or tree height is caught as well as a wrong
+// digest, and the error names the parts that differ.
+func VerifyPieceCIDV2(c cid.Cid, digest []byte, unpaddedSize uint64) error {
+	expected, err := DataCommitmentV1ToPieceMhCID(digest, unpaddedSize)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(c.Bytes(), expected.Bytes()) {
+		return nil
+	}
+
+	commD, height, padding, err := decodePieceMhCID(c)
+	if err != nil {
+		return xerrors.Errorf("piece CID %s is not a valid v2 piece CID: %w", c, err)
+	}
+	_, expectedHeight, expectedPadding, _ := decodePieceMhCID(expected)
+
+	var diffs []string
+	if !bytes.Equal(commD, digest) {
+		diffs = append(diffs, "commitment")
+	}
+	if height != expectedHeight {
+		diffs = append(diffs, "tree height")
+	}
+	if padding != expectedPadding {
+		diffs = append(diffs, "padding")
+	}
+	if len(diffs) == 0 {
+		// same fields, so the difference is in the CID encoding itself
+		diffs = append(diffs, "encoding")
+	}
+	return xerrors.Errorf("piece CID mismatch in %s: expected %s, got %s", strings.Join(diffs, ", "), expected, c)
+}
+
+// V1WithSizeEqualsV2 reports whether the v1 piece CID v1 over unpaddedSize
+// bytes describes the same piece as the v2 piece CID v2, by converting v1 and
+// comparing the CID bytes. It errors if either CID is not of its expected kind
+// or the size is not a valid piece size.
+func V1WithSizeEqualsV2(v1 cid.Cid, unpaddedSize uint64, v2 cid.Cid) (bool, error) {
+	if err := RequireType(v1, CommitmentTypeData); err != nil {
+		return false, err
+	}
+	if err := ValidatePieceCIDV2(v2); err != nil {
+		return false, err
+	}
+	converted, err := ConvertDataCommitmentV1V1CIDtoPieceMhCID(v1, unpaddedSize)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(converted.Bytes(), v2.Bytes()), nil
+}
@@ -0,0 +1,435 @@
+package commcid_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// fixture32GiBEmptyV1 and fixture32GiBEmptyV2 are the piece CIDs of a
+	// 32GiB sector filled entirely with zeros
+	fixture32GiBEmptyV1 = "baga6ea4seaqao7s73y24kcutaosvacpdjgfe5pw76ooefnyqw4ynr3d2y6x2mpq"
+	fixture32GiBEmptyV2 = "bafkzcibcaapao7s73y24kcutaosvacpdjgfe5pw76ooefnyqw4ynr3d2y6x2mpq"
+	// fixture32GiBUnpadded is the exact unpadded capacity of a 32GiB piece
+	fixture32GiBUnpadded = 32 << 30 / 128 * 127
+)
+
+func TestDataCommitmentV1ToPieceMhCID(t *testing.T) {
+	v1 := cid.MustParse(fixture32GiBEmptyV1)
+	commD, err := commcid.CIDToDataCommitmentV1(v1)
+	require.NoError(t, err)
+
+	c, err := commcid.DataCommitmentV1ToPieceMhCID(commD, fixture32GiBUnpadded)
+	require.NoError(t, err)
+	require.Equal(t, fixture32GiBEmptyV2, c.String())
+	require.Equal(t, c.Prefix().Codec, uint64(cid.Raw))
+	require.Equal(t, c.Prefix().MhType, uint64(commcid.FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE))
+
+	t.Run("error on wrong commitment length", func(t *testing.T) {
+		_, err := commcid.DataCommitmentV1ToPieceMhCID(commD[1:], fixture32GiBUnpadded)
+		require.ErrorIs(t, err, commcid.ErrIncorrectLength)
+		require.EqualError(t, err, "commitments must be 32 bytes long, got 31")
+	})
+
+	t.Run("error on too small payload", func(t *testing.T) {
+		_, err := commcid.DataCommitmentV1ToPieceMhCID(commD, 126)
+		require.EqualError(t, err, "unpadded piece size must be at least 127 bytes, got 126")
+	})
+
+	t.Run("error on top bits set", func(t *testing.T) {
+		invalid := bytes.Repeat([]byte{0xff}, 32)
+		_, err := commcid.DataCommitmentV1ToPieceMhCID(invalid, 1000)
+		require.ErrorIs(t, err, commcid.ErrInvalidTruncatedDigest)
+		_, err = commcid.DataCommitmentV1ToPieceMhCIDFromPadded(invalid, 1024)
+		require.ErrorIs(t, err, commcid.ErrInvalidTruncatedDigest)
+	})
+}
+
+func TestDataCommitmentV1ToPieceMhCIDFromPadded(t *testing.T) {
+	commD := testRandomCommitments(t, 1)[0]
+	for _, tc := range []struct {
+		padded   uint64
+		unpadded uint64
+	}{
+		{128, 127},
+		{512, 508},
+		{32 << 30, fixture32GiBUnpadded},
+	} {
+		fromPadded, err := commcid.DataCommitmentV1ToPieceMhCIDFromPadded(commD, tc.padded)
+		require.NoError(t, err)
+		fromUnpadded, err := commcid.DataCommitmentV1ToPieceMhCID(commD, tc.unpadded)
+		require.NoError(t, err)
+		require.Equal(t, fromUnpadded, fromPadded)
+
+		height, padding, err := commcid.PieceMhCIDToTreeHeightAndPadding(fromPadded)
+		require.NoError(t, err)
+		require.Equal(t, tc.padded, uint64(32)<<height)
+		require.Zero(t, padding)
+	}
+
+	for _, padded := range []uint64{0, 64, 1000, 32<<30 + 128} {
+		_, err := commcid.DataCommitmentV1ToPieceMhCIDFromPadded(commD, padded)
+		require.Error(t, err, "padded size %d", padded)
+	}
+	_, err := commcid.DataCommitmentV1ToPieceMhCIDFromPadded(commD[1:], 128)
+	require.ErrorIs(t, err, commcid.ErrIncorrectLength)
+}
+
+func TestPieceMhCIDToDataCommitmentV1(t *testing.T) {
+	randBytes := make([]byte, 32)
+	_, err := rand.Read(randBytes)
+	require.NoError(t, err)
+	randBytes[31] &= 0x3f
+
+	t.Run("round trips commitment and size", func(t *testing.T) {
+		for _, size := range []uint64{127, 128, 508, 509, fixture32GiBUnpadded} {
+			c, err := commcid.DataCommitmentV1ToPieceMhCID(randBytes, size)
+			require.NoError(t, err)
+			commD, unpaddedSize, err := commcid.PieceMhCIDToDataCommitmentV1(c)
+			require.NoError(t, err)
+			require.Equal(t, randBytes, commD)
+			require.Equal(t, size, unpaddedSize)
+		}
+	})
+
+	t.Run("error on v1 piece CID", func(t *testing.T) {
+		c, err := commcid.PieceCommitmentV1ToCID(randBytes)
+		require.NoError(t, err)
+		_, _, err = commcid.PieceMhCIDToDataCommitmentV1(c)
+		require.EqualError(t, err, commcid.ErrIncorrectHash.Error())
+	})
+
+	t.Run("error on non-raw codec", func(t *testing.T) {
+		c := cid.NewCidV1(cid.DagCBOR, cid.MustParse(fixture32GiBEmptyV2).Hash())
+		_, _, err := commcid.PieceMhCIDToDataCommitmentV1(c)
+		require.EqualError(t, err, commcid.ErrIncorrectCodec.Error())
+	})
+
+	t.Run("error on short digest", func(t *testing.T) {
+		c := cid.NewCidV1(cid.Raw, testMultiHash(commcid.FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE, append([]byte{0, 30}, randBytes[1:]...), 0))
+		_, _, err := commcid.PieceMhCIDToDataCommitmentV1(c)
+		require.EqualError(t, err, "piece multihash digest must hold padding, tree height and a 32 byte commitment")
+	})
+
+	t.Run("error on incorrectly formatted hash", func(t *testing.T) {
+		c := cid.NewCidV1(cid.Raw, testMultiHash(commcid.FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE, randBytes, 5))
+		_, _, err := commcid.PieceMhCIDToDataCommitmentV1(c)
+		require.Regexp(t, "^Error decoding data commitment hash:", err.Error())
+	})
+
+	t.Run("error on other hash type", func(t *testing.T) {
+		encoded, err := multihash.Encode(randBytes, multihash.SHA2_256)
+		require.NoError(t, err)
+		_, _, err = commcid.PieceMhCIDToDataCommitmentV1(cid.NewCidV1(cid.Raw, encoded))
+		require.EqualError(t, err, commcid.ErrIncorrectHash.Error())
+	})
+}
+
+func TestAccountingInfo(t *testing.T) {
+	paddedSize, unpaddedCapacity, fr32Overhead, err := commcid.AccountingInfo(cid.MustParse(fixture32GiBEmptyV2))
+	require.NoError(t, err)
+	require.Equal(t, uint64(32<<30), paddedSize)
+	require.Equal(t, uint64(fixture32GiBUnpadded), unpaddedCapacity)
+	require.Equal(t, uint64(32<<30/128), fr32Overhead)
+	require.Equal(t, paddedSize, unpaddedCapacity+fr32Overhead)
+
+	_, _, _, err = commcid.AccountingInfo(cid.MustParse(fixture32GiBEmptyV1))
+	require.EqualError(t, err, commcid.ErrIncorrectHash.Error())
+}
+
+func TestConvertDataCommitmentV1PieceMhCID(t *testing.T) {
+	v2, err := commcid.ConvertDataCommitmentV1V1CIDtoPieceMhCID(cid.MustParse(fixture32GiBEmptyV1), fixture32GiBUnpadded)
+	require.NoError(t, err)
+	require.Equal(t, fixture32GiBEmptyV2, v2.String())
+
+	v1, unpaddedSize, err := commcid.ConvertDataCommitmentV1PieceMhCIDToV1CID(v2)
+	require.NoError(t, err)
+	require.Equal(t, fixture32GiBEmptyV1, v1.String())
+	require.Equal(t, uint64(fixture32GiBUnpadded), unpaddedSize)
+
+	_, err = commcid.ConvertDataCommitmentV1V1CIDtoPieceMhCID(v2, fixture32GiBUnpadded)
+	require.EqualError(t, err, commcid.ErrIncorrectCodec.Error())
+
+	_, _, err = commcid.ConvertDataCommitmentV1PieceMhCIDToV1CID(v1)
+	require.EqualError(t, err, commcid.ErrIncorrectHash.Error())
+}
+
+func TestConvertDataCommitmentV1V1CIDtoPieceMhCIDWithPaddedSize(t *testing.T) {
+	v2, err := commcid.ConvertDataCommitmentV1V1CIDtoPieceMhCIDWithPaddedSize(cid.MustParse(fixture32GiBEmptyV1), 32<<30)
+	require.NoError(t, err)
+	require.Equal(t, fixture32GiBEmptyV2, v2.String())
+
+	// data that leaves padding in its tree cannot be recovered from the
+	// padded size, so the tree is taken as full
+	v2, err = commcid.ConvertDataCommitmentV1V1CIDtoPieceMhCIDWithPaddedSize(cid.MustParse(fixture127OfEach0123PieceCID), 512)
+	require.NoError(t, err)
+	_, unpaddedSize, err := commcid.PieceMhCIDToDataCommitmentV1(v2)
+	require.NoError(t, err)
+	require.Equal(t, uint64(508), unpaddedSize)
+
+	_, err = commcid.ConvertDataCommitmentV1V1CIDtoPieceMhCIDWithPaddedSize(cid.MustParse(fixture32GiBEmptyV1), 1000)
+	require.EqualError(t, err, "padded piece size 1000 must be a power of two between 128 and 9223372036854775808")
+
+	_, err = commcid.ConvertDataCommitmentV1V1CIDtoPieceMhCIDWithPaddedSize(cid.MustParse(fixture32GiBEmptyV2), 32<<30)
+	require.ErrorIs(t, err, commcid.ErrIncorrectCodec)
+}
+
+func TestValidatePieceCIDConsistency(t *testing.T) {
+	require.NoError(t, commcid.ValidatePieceCIDConsistency(cid.MustParse(fixture32GiBEmptyV1), fixture32GiBUnpadded))
+	require.NoError(t, commcid.ValidatePieceCIDConsistency(cid.MustParse(fixture32GiBEmptyV2), 0))
+	require.NoError(t, commcid.ValidatePieceCIDConsistency(cid.MustParse(fixture127OfEach0123PieceCID), 508))
+
+	err := commcid.ValidatePieceCIDConsistency(cid.MustParse(fixture32GiBEmptyV1), 126)
+	require.EqualError(t, err, "unpadded piece size must be at least 127 bytes, got 126")
+
+	replicaCid, err := commcid.ReplicaCommitmentV1ToCID(make([]byte, 32))
+	require.NoError(t, err)
+	require.EqualError(t, commcid.ValidatePieceCIDConsistency(replicaCid, 508), commcid.ErrIncorrectCodec.Error())
+}
+
+func TestNewPieceCIDV2(t *testing.T) {
+	randBytes := make([]byte, 32)
+	_, err := rand.Read(randBytes)
+	require.NoError(t, err)
+	randBytes[31] &= 0x3f
+
+	c, err := commcid.DataCommitmentV1ToPieceMhCID(randBytes, 1000)
+	require.NoError(t, err)
+	p, err := commcid.NewPieceCIDV2(c)
+	require.NoError(t, err)
+	require.Equal(t, c, p.CID())
+	require.Equal(t, randBytes, p.Digest())
+	require.Equal(t, uint8(5), p.TreeHeight())
+	require.Equal(t, uint64(1016-1000), p.PaddingSize())
+	require.Equal(t, uint64(1000), p.UnpaddedSize())
+	require.Equal(t, uint64(1024), p.PaddedSize())
+
+	// the digest cannot be changed through the returned slice
+	p.Digest()[0]++
+	require.Equal(t, randBytes, p.Digest())
+
+	p, err = commcid.NewPieceCIDV2(cid.MustParse(fixture32GiBEmptyV2))
+	require.NoError(t, err)
+	require.Equal(t, uint8(30), p.TreeHeight())
+	require.Zero(t, p.PaddingSize())
+	require.Equal(t, uint64(fixture32GiBUnpadded), p.UnpaddedSize())
+	require.Equal(t, uint64(32<<30), p.PaddedSize())
+
+	t.Run("error on v1 piece CID", func(t *testing.T) {
+		_, err := commcid.NewPieceCIDV2(cid.MustParse(fixture32GiBEmptyV1))
+		require.ErrorIs(t, err, commcid.ErrIncorrectHash)
+	})
+}
+
+func TestVerifyPieceCIDV2(t *testing.T) {
+	c := cid.MustParse(fixture32GiBEmptyV2)
+	commD, unpaddedSize, err := commcid.PieceMhCIDToDataCommitmentV1(c)
+	require.NoError(t, err)
+	require.NoError(t, commcid.VerifyPieceCIDV2(c, commD, unpaddedSize))
+
+	// a size in the same tree only changes the padding
+	err = commcid.VerifyPieceCIDV2(c, commD, unpaddedSize-1)
+	require.Regexp(t, "^piece CID mismatch in padding: expected \\w+, got "+fixture32GiBEmptyV2+"$", err.Error())
+
+	err = commcid.VerifyPieceCIDV2(c, commD, unpaddedSize+1)
+	require.Regexp(t, "^piece CID mismatch in tree height, padding: ", err.Error())
+
+	other := append([]byte{}, commD...)
+	other[0]++
+	err = commcid.VerifyPieceCIDV2(c, other, unpaddedSize)
+	require.Regexp(t, "^piece CID mismatch in commitment: ", err.Error())
+
+	t.Run("error on a CID that is not a v2 piece CID", func(t *testing.T) {
+		err := commcid.VerifyPieceCIDV2(cid.MustParse(fixture32GiBEmptyV1), commD, unpaddedSize)
+		require.ErrorIs(t, err, commcid.ErrIncorrectHash)
+	})
+}
+
+// testPieceMhCIDVectors returns valid and invalid v2 piece CIDs covering every
+// failure mode of the v2 piece CID decoder
+func testPieceMhCIDVectors(t testing.TB, commD []byte) []cid.Cid {
+	var vectors []cid.Cid
+	for _, size := range []uint64{127, 128, 508, 509, fixture32GiBUnpadded} {
+		c, err := commcid.DataCommitmentV1ToPieceMhCID(commD, size)
+		require.NoError(t, err)
+		vectors = append(vectors, c)
+	}
+
+	v1, err := commcid.PieceCommitmentV1ToCID(commD)
+	require.NoError(t, err)
+	sha, err := multihash.Encode(commD, multihash.SHA2_256)
+	require.NoError(t, err)
+	rawPiece := func(digest []byte) cid.Cid {
+		return cid.NewCidV1(cid.Raw, testMultiHash(commcid.FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE, digest, 0))
+	}
+	return append(vectors,
+		v1,
+		cid.NewCidV1(cid.DagCBOR, cid.MustParse(fixture32GiBEmptyV2).Hash()),
+		cid.NewCidV1(cid.Raw, sha),
+		cid.NewCidV1(cid.Raw, testMultiHash(commcid.FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE, commD, 5)),
+		rawPiece(append([]byte{0, 30}, commD[1:]...)),
+		// non-minimal padding varint
+		rawPiece(append([]byte{0x80, 0x00, 30}, commD...)),
+		// tree heights out of range
+		rawPiece(append([]byte{0, 1}, commD...)),
+		rawPiece(append([]byte{0, 59}, commD...)),
+		// padding of a whole height 2 tree
+		rawPiece(append([]byte{127, 2}, commD...)),
+	)
+}
+
+func TestPieceMhCIDToUnpaddedSize(t *testing.T) {
+	commD := testRandomCommitments(t, 1)[0]
+	for _, c := range testPieceMhCIDVectors(t, commD) {
+		_, expected, expectedErr := commcid.PieceMhCIDToDataCommitmentV1(c)
+		size, err := commcid.PieceMhCIDToUnpaddedSize(c)
+		if expectedErr != nil {
+			require.EqualError(t, err, expectedErr.Error(), "CID %s", c)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, expected, size)
+	}
+
+	size, err := commcid.PieceMhCIDToUnpaddedSize(cid.MustParse(fixture32GiBEmptyV2))
+	require.NoError(t, err)
+	require.Equal(t, uint64(fixture32GiBUnpadded), size)
+}
+
+func BenchmarkPieceMhCIDToUnpaddedSize(b *testing.B) {
+	c := cid.MustParse(fixture32GiBEmptyV2)
+	b.Run("size only", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := commcid.PieceMhCIDToUnpaddedSize(c); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("full decoder", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, _, err := commcid.PieceMhCIDToDataCommitmentV1(c); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestPieceMhCIDToTreeHeightAndPadding(t *testing.T) {
+	height, padding, err := commcid.PieceMhCIDToTreeHeightAndPadding(cid.MustParse(fixture32GiBEmptyV2))
+	require.NoError(t, err)
+	require.Equal(t, uint8(30), height)
+	require.Zero(t, padding)
+
+	commD := testRandomCommitments(t, 1)[0]
+	c, err := commcid.DataCommitmentV1ToPieceMhCID(commD, 1000)
+	require.NoError(t, err)
+	height, padding, err = commcid.PieceMhCIDToTreeHeightAndPadding(c)
+	require.NoError(t, err)
+	require.Equal(t, uint8(5), height)
+	require.Equal(t, uint64(16), padding)
+
+	_, _, err = commcid.PieceMhCIDToTreeHeightAndPadding(cid.MustParse(fixture32GiBEmptyV1))
+	require.ErrorIs(t, err, commcid.ErrIncorrectHash)
+
+	for _, c := range testPieceMhCIDVectors(t, commD) {
+		p, expectedErr := commcid.NewPieceCIDV2(c)
+		height, padding, err := commcid.PieceMhCIDToTreeHeightAndPadding(c)
+		if expectedErr != nil {
+			require.EqualError(t, err, expectedErr.Error(), "CID %s", c)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, p.TreeHeight(), height)
+		require.Equal(t, p.PaddingSize(), padding)
+	}
+}
+
+func TestValidatePieceCIDV2(t *testing.T) {
+	require.NoError(t, commcid.ValidatePieceCIDV2(cid.MustParse(fixture32GiBEmptyV2)))
+
+	commD := testRandomCommitments(t, 1)[0]
+	rawPiece := func(digest ...[]byte) cid.Cid {
+		return cid.NewCidV1(cid.Raw, testMultiHash(commcid.FR32_SHA256_TRUNC254_PADDED_BINARY_TREE_CODE, bytes.Join(digest, nil), 0))
+	}
+	v1, err := commcid.PieceCommitmentV1ToCID(commD)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name     string
+		c        cid.Cid
+		expected error
+	}{
+		{"v1 piece CID", v1, commcid.ErrIncorrectHash},
+		{"non-raw codec", cid.NewCidV1(cid.DagCBOR, cid.MustParse(fixture32GiBEmptyV2).Hash()), commcid.ErrIncorrectCodec},
+		{"short digest", rawPiece([]byte{0, 30}, commD[1:]), commcid.ErrInvalidPieceDigest},
+		{"long digest", rawPiece([]byte{0, 30}, commD, []byte{0}), commcid.ErrInvalidPieceDigest},
+		{"tree height too small", rawPiece([]byte{0, 1}, commD), commcid.ErrInvalidTreeHeight},
+		{"tree height too large", rawPiece([]byte{0, 59}, commD), commcid.ErrInvalidTreeHeight},
+		{"padding of the whole tree", rawPiece([]byte{127, 2}, commD), commcid.ErrPaddingExceedsCapacity},
+		// 2^32 bytes of padding in a 512 byte tree
+		{"oversized padding", rawPiece([]byte{0x80, 0x80, 0x80, 0x80, 0x10, 4}, commD), commcid.ErrPaddingExceedsCapacity},
+		{"top bits set", rawPiece([]byte{0, 30}, bytes.Repeat([]byte{0xff}, 32)), commcid.ErrInvalidTruncatedDigest},
+	} {
+		err := commcid.ValidatePieceCIDV2(tc.c)
+		require.ErrorIs(t, err, tc.expected, tc.name)
+	}
+
+	t.Run("top bits set is not a v2 piece CID", func(t *testing.T) {
+		// the digest DataCommitmentV1ToPieceMhCID would build for 0xff*32 over
+		// 1000 bytes, were it not rejected
+		invalid := rawPiece([]byte{16, 5}, bytes.Repeat([]byte{0xff}, 32))
+		_, _, err := commcid.PieceMhCIDToDataCommitmentV1(invalid)
+		require.ErrorIs(t, err, commcid.ErrInvalidTruncatedDigest)
+		_, err = commcid.NewPieceCIDV2(invalid)
+		require.ErrorIs(t, err, commcid.ErrInvalidTruncatedDigest)
+		require.Equal(t, commcid.CommitmentTypeUnknown, commcid.Classify(invalid))
+		require.Equal(t, commcid.KindUnknown, commcid.KindOf(invalid))
+	})
+
+	err = commcid.ValidatePieceCIDV2(rawPiece([]byte{0xff, 0x01, 3}, commD))
+	require.EqualError(t, err, "padding exceeds tree capacity, got 255 for capacity 254")
+
+	err = commcid.ValidatePieceCIDV2(rawPiece([]byte{0x80, 0x00, 30}, commD))
+	var decodeErr *commcid.DecodeError
+	require.True(t, errors.As(err, &decodeErr))
+	require.Equal(t, "piece padding", decodeErr.Stage)
+}
+
+func TestV1WithSizeEqualsV2(t *testing.T) {
+	v1 := cid.MustParse(fixture32GiBEmptyV1)
+	v2 := cid.MustParse(fixture32GiBEmptyV2)
+
+	equal, err := commcid.V1WithSizeEqualsV2(v1, fixture32GiBUnpadded, v2)
+	require.NoError(t, err)
+	require.True(t, equal)
+
+	// same commitment, but the size changes the padding
+	equal, err = commcid.V1WithSizeEqualsV2(v1, fixture32GiBUnpadded-1, v2)
+	require.NoError(t, err)
+	require.False(t, equal)
+
+	equal, err = commcid.V1WithSizeEqualsV2(cid.MustParse(fixture127OfEach0123PieceCID), fixture32GiBUnpadded, v2)
+	require.NoError(t, err)
+	require.False(t, equal)
+
+	t.Run("error on CIDs of the wrong kind", func(t *testing.T) {
+		_, err := commcid.V1WithSizeEqualsV2(v2, fixture32GiBUnpadded, v2)
+		require.EqualError(t, err, "expected data commitment, got v2 piece commitment: unexpected commitment codec")
+		_, err = commcid.V1WithSizeEqualsV2(v1, fixture32GiBUnpadded, v1)
+		require.ErrorIs(t, err, commcid.ErrIncorrectHash)
+	})
+
+	t.Run("error on invalid size", func(t *testing.T) {
+		_, err := commcid.V1WithSizeEqualsV2(v1, 126, v2)
+		require.EqualError(t, err, "unpadded piece size must be at least 127 bytes, got 126")
+	})
+}
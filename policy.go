@@ -0,0 +1,57 @@
+package commcid
+
+import (
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// PolicyValidator decides whether a commitment CID is acceptable. Services can
+// supply their own implementation to enforce rules stricter than the default.
+type PolicyValidator interface {
+	Validate(c cid.Cid) error
+}
+
+// Policy is the baseline PolicyValidator. It accepts any well formed data,
+// replica or v2 piece CID, and can additionally bound the padded size of v2
+// piece CIDs, which are the only kind to carry a size.
+type Policy struct {
+	// MinPaddedSize is the smallest padded piece size accepted; 0 disables the check
+	MinPaddedSize uint64
+	// MaxPaddedSize is the largest padded piece size accepted; 0 disables the check
+	MaxPaddedSize uint64
+}
+
+var _ PolicyValidator = Policy{}
+
+// DefaultPolicy returns the policy enforcing the current codec, hash and size
+// rules of this package
+func DefaultPolicy() Policy {
+	return Policy{}
+}
+
+// Validate returns an error if the CID is not a valid commitment or its piece
+// size falls outside the bounds of the policy
+func (p Policy) Validate(c cid.Cid) error {
+	switch Classify(c) {
+	case CommitmentTypeData, CommitmentTypeReplica:
+		return nil
+	case CommitmentTypePieceV2:
+		paddedSize, _, _, err := AccountingInfo(c)
+		if err != nil {
+			return err
+		}
+		if p.MinPaddedSize != 0 && paddedSize < p.MinPaddedSize {
+			return xerrors.Errorf("padded piece size %d is below the policy minimum of %d", paddedSize, p.MinPaddedSize)
+		}
+		if p.MaxPaddedSize != 0 && paddedSize > p.MaxPaddedSize {
+			return xerrors.Errorf("padded piece size %d is above the policy maximum of %d", paddedSize, p.MaxPaddedSize)
+		}
+		return nil
+	default:
+		// surface why the CID is not a commitment
+		if _, _, _, err := CIDToCommitment(c); err != nil {
+			return err
+		}
+		return ErrIncorrectCodec
+	}
+}
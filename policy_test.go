@@ -0,0 +1,48 @@
+package commcid_test
+
+import (
+	"crypto/rand"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	randBytes := make([]byte, 32)
+	_, err := rand.Read(randBytes)
+	require.NoError(t, err)
+	randBytes[31] &= 0x3f
+
+	policy := commcid.DefaultPolicy()
+
+	dataCid, err := commcid.DataCommitmentV1ToCID(randBytes)
+	require.NoError(t, err)
+	require.NoError(t, policy.Validate(dataCid))
+
+	replicaCid, err := commcid.ReplicaCommitmentV1ToCID(randBytes)
+	require.NoError(t, err)
+	require.NoError(t, policy.Validate(replicaCid))
+
+	require.NoError(t, policy.Validate(cid.MustParse(fixture32GiBEmptyV2)))
+
+	c := cid.NewCidV1(cid.DagCBOR, testMultiHash(multihash.SHA2_256_TRUNC254_PADDED, randBytes, 0))
+	require.EqualError(t, policy.Validate(c), commcid.ErrIncorrectCodec.Error())
+}
+
+func TestPolicyMinPaddedSize(t *testing.T) {
+	randBytes := make([]byte, 32)
+	_, err := rand.Read(randBytes)
+	require.NoError(t, err)
+	randBytes[31] &= 0x3f
+
+	var policy commcid.PolicyValidator = commcid.Policy{MinPaddedSize: 1 << 20}
+
+	small, err := commcid.DataCommitmentV1ToPieceMhCID(randBytes, 127)
+	require.NoError(t, err)
+	require.EqualError(t, policy.Validate(small), "padded piece size 128 is below the policy minimum of 1048576")
+
+	require.NoError(t, policy.Validate(cid.MustParse(fixture32GiBEmptyV2)))
+}
@@ -0,0 +1,61 @@
+package commcid
+
+import (
+	"io"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// PieceCIDWithProofFor computes the v1 piece CID and padded piece size of the
+// first size bytes of r, and captures the inclusion proof for the leaf at
+// leafIndex while building the tree. The proof holds the 32 byte leaf itself
+// followed by its sibling at every layer from the bottom up; hashing the leaf
+// with each sibling in turn, on the side given by the matching bit of
+// leafIndex, yields the root.
+func PieceCIDWithProofFor(r io.ReaderAt, size int64, leafIndex uint64) (cid.Cid, uint64, [][]byte, error) {
+	if size < 0 {
+		return cid.Undef, 0, nil, xerrors.Errorf("invalid size %d", size)
+	}
+	if err := validatePayloadSize(uint64(size)); err != nil {
+		return cid.Undef, 0, nil, err
+	}
+	height := paddedTreeHeight(uint64(size))
+	if leafIndex>>height != 0 {
+		return cid.Undef, 0, nil, xerrors.Errorf("leaf index %d out of range for tree height %d", leafIndex, height)
+	}
+
+	// anything not built from data is a zero leaf or subtree
+	var leaf [nodeSize]byte
+	siblings := make([][nodeSize]byte, height)
+	copy(siblings, zeroCommitments[:height])
+	observe := func(layer uint8, index uint64, node *[nodeSize]byte) {
+		switch {
+		case layer == 0 && index == leafIndex:
+			leaf = *node
+		case layer < height && index == (leafIndex>>layer)^1:
+			siblings[layer] = *node
+		}
+	}
+
+	var b PieceBuilder
+	sr := io.NewSectionReader(r, 0, size)
+	if err := b.readFrom(sr, make([]byte, readChunkSize), observe, nil); err != nil {
+		return cid.Undef, 0, nil, err
+	}
+	if b.unpadded != uint64(size) {
+		return cid.Undef, 0, nil, xerrors.Errorf("data ended after %d of %d bytes", b.unpadded, size)
+	}
+
+	root := b.root(height, observe)
+	c, err := PieceCommitmentV1ToCID(root[:])
+	if err != nil {
+		return cid.Undef, 0, nil, err
+	}
+	proof := make([][]byte, 0, height+1)
+	proof = append(proof, leaf[:])
+	for i := range siblings {
+		proof = append(proof, siblings[i][:])
+	}
+	return c, nodeSize << height, proof, nil
+}
@@ -0,0 +1,70 @@
+package commcid_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+// testVerifyProof hashes the leaf at the head of proof up through its siblings
+// and returns the resulting root
+func testVerifyProof(proof [][]byte, leafIndex uint64) []byte {
+	node := proof[0]
+	for _, sibling := range proof[1:] {
+		var pair []byte
+		if leafIndex&1 == 0 {
+			pair = append(append(pair, node...), sibling...)
+		} else {
+			pair = append(append(pair, sibling...), node...)
+		}
+		sum := sha256.Sum256(pair)
+		sum[31] &= 0x3f
+		node = sum[:]
+		leafIndex >>= 1
+	}
+	return node
+}
+
+func TestPieceCIDWithProofFor(t *testing.T) {
+	// the fixture fills all 16 leaves of its tree
+	commP, err := commcid.CIDToPieceCommitmentV1(cid.MustParse(fixture127OfEach0123PieceCID))
+	require.NoError(t, err)
+	for _, leafIndex := range []uint64{0, 5, 15} {
+		c, paddedSize, proof, err := commcid.PieceCIDWithProofFor(bytes.NewReader(fixture127OfEach0123), int64(len(fixture127OfEach0123)), leafIndex)
+		require.NoError(t, err)
+		require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+		require.Equal(t, uint64(512), paddedSize)
+		require.Len(t, proof, 5)
+		require.Equal(t, commP, testVerifyProof(proof, leafIndex), "leaf %d", leafIndex)
+	}
+
+	t.Run("leaves in the zero padding", func(t *testing.T) {
+		data := bytes.Repeat(fixture127OfEach0123, 5)
+		expected, expectedSize, err := commcid.PieceCIDFromReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		expectedCommP, err := commcid.CIDToPieceCommitmentV1(expected)
+		require.NoError(t, err)
+
+		for _, leafIndex := range []uint64{3, 79, 80, 100, 127} {
+			c, paddedSize, proof, err := commcid.PieceCIDWithProofFor(bytes.NewReader(data), int64(len(data)), leafIndex)
+			require.NoError(t, err)
+			require.Equal(t, expected, c)
+			require.Equal(t, expectedSize, paddedSize)
+			require.Equal(t, expectedCommP, testVerifyProof(proof, leafIndex), "leaf %d", leafIndex)
+		}
+	})
+
+	t.Run("error on leaf index out of range", func(t *testing.T) {
+		_, _, _, err := commcid.PieceCIDWithProofFor(bytes.NewReader(fixture127OfEach0123), int64(len(fixture127OfEach0123)), 16)
+		require.EqualError(t, err, "leaf index 16 out of range for tree height 4")
+	})
+
+	t.Run("error on short data", func(t *testing.T) {
+		_, _, _, err := commcid.PieceCIDWithProofFor(bytes.NewReader(fixture127OfEach0123), 1000, 0)
+		require.EqualError(t, err, "data ended after 508 of 1000 bytes")
+	})
+}
@@ -0,0 +1,497 @@
+package commcid
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"io"
+	"math"
+	"slices"
+	"unsafe"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// PieceCIDFromInterleavedReaders computes the v1 piece CID and padded piece
+// size of a piece striped across several readers, reassembling it by reading
+// stripeSize bytes from each reader in turn. The piece ends at the first short
+// stripe; all other readers must be exhausted at that point.
+func PieceCIDFromInterleavedReaders(readers []io.Reader, stripeSize int) (cid.Cid, uint64, error) {
+	if len(readers) == 0 {
+		return cid.Undef, 0, xerrors.New("no readers given")
+	}
+	if stripeSize <= 0 {
+		return cid.Undef, 0, xerrors.Errorf("stripe size must be positive, got %d", stripeSize)
+	}
+	return PieceCIDFromReader(&interleavedReader{readers: readers, stripeSize: stripeSize})
+}
+
+type interleavedReader struct {
+	readers    []io.Reader
+	stripeSize int
+	current    int
+	remaining  int
+	done       bool
+}
+
+func (ir *interleavedReader) Read(p []byte) (int, error) {
+	if ir.done {
+		return 0, io.EOF
+	}
+	if ir.remaining == 0 {
+		ir.remaining = ir.stripeSize
+	}
+	if len(p) > ir.remaining {
+		p = p[:ir.remaining]
+	}
+
+	n, err := io.ReadFull(ir.readers[ir.current], p)
+	ir.remaining -= n
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		ir.done = true
+		if err := ir.checkExhausted(); err != nil {
+			return n, err
+		}
+		if n == 0 {
+			return 0, io.EOF
+		}
+		return n, nil
+	case err != nil:
+		return n, err
+	}
+
+	if ir.remaining == 0 {
+		ir.current = (ir.current + 1) % len(ir.readers)
+	}
+	return n, nil
+}
+
+// checkExhausted ensures no reader other than the one that ended holds data
+// beyond the end of the piece
+func (ir *interleavedReader) checkExhausted() error {
+	var probe [1]byte
+	for i, r := range ir.readers {
+		if i == ir.current {
+			continue
+		}
+		n, err := io.ReadFull(r, probe[:])
+		if n > 0 {
+			return xerrors.Errorf("reader %d holds data past the end of reader %d", i, ir.current)
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+	}
+	return nil
+}
+
+// PieceCIDFromReaderBounded computes the v1 piece CID and padded piece size of
+// all data read from r while keeping the hashing state and read buffer within
+// maxMemBytes. The builder state is fixed in size, so the budget only limits
+// how much data is read per step; it errors if the budget cannot fit the
+// builder and a single 127 byte chunk.
+func PieceCIDFromReaderBounded(r io.Reader, maxMemBytes uint64) (cid.Cid, uint64, error) {
+	const builderSize = uint64(unsafe.Sizeof(PieceBuilder{}))
+	if maxMemBytes < builderSize+fr32UnpaddedChunk {
+		return cid.Undef, 0, xerrors.Errorf("memory budget of %d bytes is below the minimum of %d", maxMemBytes, builderSize+fr32UnpaddedChunk)
+	}
+
+	bufSize := min(maxMemBytes-builderSize, readChunkSize) / fr32UnpaddedChunk * fr32UnpaddedChunk
+	commP, _, paddedSize, err := dataCommitmentFromReader(r, int(bufSize))
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	c, err := PieceCommitmentV1ToCID(commP)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	return c, paddedSize, nil
+}
+
+// SubPieceCID computes the v1 piece CID and padded piece size of length bytes
+// of fullData starting at start, treating the range as a standalone piece.
+// The range does not need to be aligned to the tree of the enclosing data.
+func SubPieceCID(fullData io.ReaderAt, start, length int64) (cid.Cid, uint64, error) {
+	if start < 0 || length < 0 {
+		return cid.Undef, 0, xerrors.Errorf("invalid range: start %d, length %d", start, length)
+	}
+
+	sr := io.NewSectionReader(fullData, start, length)
+	// check the range lies within the data before its size, so a short range
+	// past the end is reported as out of range
+	if length > 0 {
+		var last [1]byte
+		if n, _ := fullData.ReadAt(last[:], start+length-1); n != 1 {
+			// a short ReaderAt ends the section early rather than erroring
+			read, _ := io.Copy(io.Discard, sr)
+			return cid.Undef, 0, xerrors.Errorf("range ends %d bytes past the end of the data", length-read)
+		}
+	}
+	if uint64(length) < MinUnpaddedPieceSize {
+		return cid.Undef, 0, xerrors.Errorf("invalid range: length %d is below the minimum piece size of %d bytes", length, MinUnpaddedPieceSize)
+	}
+
+	return PieceCIDFromReader(sr)
+}
+
+// PieceCIDFromSeeker computes the v1 piece CID and padded piece size of the
+// data between the current position of rs and its end. The size is found by
+// seeking, and the original position is restored before returning.
+func PieceCIDFromSeeker(rs io.ReadSeeker) (cid.Cid, uint64, error) {
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	if _, err := rs.Seek(start, io.SeekStart); err != nil {
+		return cid.Undef, 0, err
+	}
+
+	c, paddedSize, err := PieceCIDFromReader(io.LimitReader(rs, end-start))
+	if _, serr := rs.Seek(start, io.SeekStart); serr != nil && err == nil {
+		err = serr
+	}
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	return c, paddedSize, nil
+}
+
+// ComparePieceCIDs hashes both readers in full and reports whether they produce
+// the same v1 piece CID, returning both CIDs so a mismatch can be reported
+func ComparePieceCIDs(a, b io.Reader) (bool, cid.Cid, cid.Cid, error) {
+	cidA, _, err := PieceCIDFromReader(a)
+	if err != nil {
+		return false, cid.Undef, cid.Undef, xerrors.Errorf("hashing first input: %w", err)
+	}
+	cidB, _, err := PieceCIDFromReader(b)
+	if err != nil {
+		return false, cid.Undef, cid.Undef, xerrors.Errorf("hashing second input: %w", err)
+	}
+	return cidA.Equals(cidB), cidA, cidB, nil
+}
+
+// PieceCIDFromRepeatedBlock computes the v1 piece CID and padded piece size of
+// block repeated count times, streaming the repetition rather than building
+// the full payload in memory
+func PieceCIDFromRepeatedBlock(block []byte, count int) (cid.Cid, uint64, error) {
+	if len(block) == 0 || count <= 0 {
+		return cid.Undef, 0, xerrors.Errorf("cannot repeat a %d byte block %d times", len(block), count)
+	}
+	return PieceCIDFromReader(&repeatReader{block: block, remaining: uint64(len(block)) * uint64(count)})
+}
+
+type repeatReader struct {
+	block     []byte
+	offset    int
+	remaining uint64
+}
+
+func (rr *repeatReader) Read(p []byte) (int, error) {
+	if rr.remaining == 0 {
+		return 0, io.EOF
+	}
+	if uint64(len(p)) > rr.remaining {
+		p = p[:rr.remaining]
+	}
+
+	var n int
+	for n < len(p) {
+		copied := copy(p[n:], rr.block[rr.offset:])
+		n += copied
+		rr.offset = (rr.offset + copied) % len(rr.block)
+	}
+	rr.remaining -= uint64(n)
+	return n, nil
+}
+
+// PieceCIDFromReaderLimited computes the v1 piece CID and padded piece size of
+// all data read from r, failing with ErrPieceTooLarge as soon as more than
+// maxBytes have been read. At most maxBytes+1 bytes are consumed from r.
+func PieceCIDFromReaderLimited(r io.Reader, maxBytes uint64) (cid.Cid, uint64, error) {
+	return PieceCIDFromReader(&limitedReader{r: r, remaining: maxBytes})
+}
+
+type limitedReader struct {
+	r         io.Reader
+	remaining uint64
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	// allow one byte past the limit through to detect oversized input
+	if lr.remaining < uint64(len(p)) {
+		p = p[:lr.remaining+1]
+	}
+	n, err := lr.r.Read(p)
+	if uint64(n) > lr.remaining {
+		return 0, ErrPieceTooLarge
+	}
+	lr.remaining -= uint64(n)
+	return n, err
+}
+
+// PrefixPieceCID computes the v1 piece CID and padded piece size of the first
+// prefixLen bytes of r as a standalone piece, reading nothing beyond them
+func PrefixPieceCID(r io.Reader, prefixLen uint64) (cid.Cid, uint64, error) {
+	if prefixLen > math.MaxInt64 {
+		return cid.Undef, 0, xerrors.Errorf("prefix length %d too large", prefixLen)
+	}
+	commP, unpaddedSize, paddedSize, err := DataCommitmentV1FromReader(io.LimitReader(r, int64(prefixLen)))
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	if unpaddedSize != prefixLen {
+		return cid.Undef, 0, xerrors.Errorf("data ended after %d bytes, before the %d byte prefix", unpaddedSize, prefixLen)
+	}
+	c, err := PieceCommitmentV1ToCID(commP)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	return c, paddedSize, nil
+}
+
+// PieceCIDWithBlockOffsets computes the v1 piece CID and padded piece size of
+// all data read from r, and maps each of the ascending blockBoundaries, given
+// as offsets into the raw data, to its offset within the padded piece
+func PieceCIDWithBlockOffsets(r io.Reader, blockBoundaries []uint64) (cid.Cid, uint64, []uint64, error) {
+	for i := 1; i < len(blockBoundaries); i++ {
+		if blockBoundaries[i] < blockBoundaries[i-1] {
+			return cid.Undef, 0, nil, xerrors.Errorf("block boundary %d at offset %d precedes the previous boundary at %d", i, blockBoundaries[i], blockBoundaries[i-1])
+		}
+	}
+
+	commP, unpaddedSize, paddedSize, err := DataCommitmentV1FromReader(r)
+	if err != nil {
+		return cid.Undef, 0, nil, err
+	}
+	if n := len(blockBoundaries); n > 0 && blockBoundaries[n-1] > unpaddedSize {
+		return cid.Undef, 0, nil, xerrors.Errorf("block boundary at offset %d is past the end of the %d byte data", blockBoundaries[n-1], unpaddedSize)
+	}
+
+	c, err := PieceCommitmentV1ToCID(commP)
+	if err != nil {
+		return cid.Undef, 0, nil, err
+	}
+	offsets := make([]uint64, len(blockBoundaries))
+	for i, b := range blockBoundaries {
+		offsets[i] = paddedOffset(b)
+	}
+	return c, paddedSize, offsets, nil
+}
+
+// Result is the outcome of an asynchronous piece CID computation
+type Result struct {
+	CID        cid.Cid
+	PaddedSize uint64
+	Err        error
+}
+
+// PieceCIDFromReaderChan computes the v1 piece CID and padded piece size of all
+// data read from r in the background. The first channel receives the number
+// of bytes hashed so far and is closed once reading ends; updates are dropped
+// rather than stalling the hasher while the receiver is busy. The second
+// channel delivers the single final Result.
+func PieceCIDFromReaderChan(r io.Reader) (<-chan uint64, <-chan Result) {
+	progress := make(chan uint64, 1)
+	result := make(chan Result, 1)
+	go func() {
+		var b PieceBuilder
+		err := b.readFrom(r, make([]byte, readChunkSize), nil, func() error {
+			select {
+			case progress <- b.unpadded:
+			default:
+			}
+			return nil
+		})
+		close(progress)
+		if err != nil {
+			result <- Result{Err: err}
+			return
+		}
+
+		commP, _, paddedSize, err := b.Digest()
+		if err != nil {
+			result <- Result{Err: err}
+			return
+		}
+		c, err := PieceCommitmentV1ToCID(commP)
+		result <- Result{CID: c, PaddedSize: paddedSize, Err: err}
+	}()
+	return progress, result
+}
+
+// PieceCIDFromReaderDetectZero computes the v1 piece CID and padded piece size
+// of all data read from r, and reports whether every byte read was zero
+func PieceCIDFromReaderDetectZero(r io.Reader) (cid.Cid, uint64, bool, error) {
+	zr := &zeroDetectReader{r: r, allZero: true}
+	c, paddedSize, err := PieceCIDFromReader(zr)
+	if err != nil {
+		return cid.Undef, 0, false, err
+	}
+	return c, paddedSize, zr.allZero, nil
+}
+
+type zeroDetectReader struct {
+	r       io.Reader
+	allZero bool
+}
+
+func (zr *zeroDetectReader) Read(p []byte) (int, error) {
+	n, err := zr.r.Read(p)
+	if zr.allZero {
+		for _, b := range p[:n] {
+			if b != 0 {
+				zr.allZero = false
+				break
+			}
+		}
+	}
+	return n, err
+}
+
+// PieceCIDFromReaderBigEndianFE computes the v1 piece CID and padded piece size
+// of data made up of 32 byte big-endian field elements, reversing each one to
+// the little-endian byte order commP packs before hashing. Use it only for
+// producers that emit big-endian field elements; for ordinary data it gives a
+// different CID than PieceCIDFromReader. The data length must be a multiple of
+// 32 bytes.
+func PieceCIDFromReaderBigEndianFE(r io.Reader) (cid.Cid, uint64, error) {
+	return PieceCIDFromReader(&feSwapReader{r: r})
+}
+
+type feSwapReader struct {
+	r      io.Reader
+	fe     [nodeSize]byte
+	offset int
+	filled bool
+}
+
+func (sr *feSwapReader) Read(p []byte) (int, error) {
+	if !sr.filled {
+		n, err := io.ReadFull(sr.r, sr.fe[:])
+		switch {
+		case err == io.EOF:
+			return 0, io.EOF
+		case err == io.ErrUnexpectedEOF:
+			return 0, xerrors.Errorf("data ends with a partial field element of %d bytes", n)
+		case err != nil:
+			return 0, err
+		}
+		slices.Reverse(sr.fe[:])
+		sr.offset = 0
+		sr.filled = true
+	}
+
+	n := copy(p, sr.fe[sr.offset:])
+	sr.offset += n
+	sr.filled = sr.offset < nodeSize
+	return n, nil
+}
+
+// PieceCIDFromReaderAligned computes the v1 piece CID and padded piece size of
+// all data read from r, failing unless the amount of data is a multiple of
+// blockSize
+func PieceCIDFromReaderAligned(r io.Reader, blockSize uint64) (cid.Cid, uint64, error) {
+	if blockSize == 0 {
+		return cid.Undef, 0, xerrors.New("block size must be positive")
+	}
+	commP, unpaddedSize, paddedSize, err := DataCommitmentV1FromReader(r)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	if rem := unpaddedSize % blockSize; rem != 0 {
+		return cid.Undef, 0, xerrors.Errorf("data size %d is not a multiple of the %d byte block size, expected %d or %d", unpaddedSize, blockSize, unpaddedSize-rem, unpaddedSize-rem+blockSize)
+	}
+	c, err := PieceCommitmentV1ToCID(commP)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	return c, paddedSize, nil
+}
+
+// PieceCIDWithFieldStats computes the v1 piece CID and padded piece size of all
+// data read from r, and counts the raw input words that are not valid field
+// elements. The input is split into 32 byte little-endian words and a word is
+// counted when either of its top two bits is set; a trailing partial word is
+// never counted. Data pre-packed as one field element per 32 bytes never has
+// such words, so a non-zero count marks data that was not pre-packed.
+//
+// The count describes the input as given, not the tree leaves: FR32 padding
+// repacks the input into 254 bit elements, so every leaf is a valid field
+// element whatever the input holds.
+func PieceCIDWithFieldStats(r io.Reader) (cid.Cid, uint64, uint64, error) {
+	fr := &fieldStatsReader{r: r}
+	c, paddedSize, err := PieceCIDFromReader(fr)
+	if err != nil {
+		return cid.Undef, 0, 0, err
+	}
+	return c, paddedSize, fr.highBitWords, nil
+}
+
+type fieldStatsReader struct {
+	r            io.Reader
+	offset       uint64
+	highBitWords uint64
+}
+
+func (fr *fieldStatsReader) Read(p []byte) (int, error) {
+	n, err := fr.r.Read(p)
+	// the top bits of each word live in its last byte
+	for i := (nodeSize - 1 - fr.offset%nodeSize) % nodeSize; i < uint64(n); i += nodeSize {
+		if p[i]&0xc0 != 0 {
+			fr.highBitWords++
+		}
+	}
+	fr.offset += uint64(n)
+	return n, err
+}
+
+// PieceCIDFromReaderWithMD5 computes the v1 piece CID and padded piece size of
+// all data read from r, failing unless the MD5 of the same bytes matches
+// expectedMD5, given base64 encoded as in an HTTP Content-MD5 header
+func PieceCIDFromReaderWithMD5(r io.Reader, expectedMD5 string) (cid.Cid, uint64, error) {
+	h := md5.New()
+	c, paddedSize, err := PieceCIDFromReader(io.TeeReader(r, h))
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	if actual := base64.StdEncoding.EncodeToString(h.Sum(nil)); actual != expectedMD5 {
+		return cid.Undef, 0, xerrors.Errorf("MD5 mismatch: expected %s, got %s", expectedMD5, actual)
+	}
+	return c, paddedSize, nil
+}
+
+// PieceCIDFromReaderExpectSize computes the v1 piece CID and padded piece size
+// of all data read from r, failing with ErrSizeMismatch unless exactly
+// declaredUnpadded bytes are read. At most one byte past the declared size is
+// consumed from r.
+func PieceCIDFromReaderExpectSize(r io.Reader, declaredUnpadded uint64) (cid.Cid, uint64, error) {
+	if err := validatePayloadSize(declaredUnpadded); err != nil {
+		return cid.Undef, 0, err
+	}
+
+	var b PieceBuilder
+	if err := b.readFrom(io.LimitReader(r, int64(declaredUnpadded)+1), make([]byte, readChunkSize), nil, nil); err != nil {
+		return cid.Undef, 0, err
+	}
+	switch {
+	case b.unpadded < declaredUnpadded:
+		return cid.Undef, 0, xerrors.Errorf("data ended after %d of %d declared bytes: %w", b.unpadded, declaredUnpadded, ErrSizeMismatch)
+	case b.unpadded > declaredUnpadded:
+		return cid.Undef, 0, xerrors.Errorf("data continues past %d declared bytes: %w", declaredUnpadded, ErrSizeMismatch)
+	}
+
+	commP, _, paddedSize, err := b.Digest()
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	c, err := PieceCommitmentV1ToCID(commP)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	return c, paddedSize, nil
+}
@@ -0,0 +1,365 @@
+package commcid_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"io"
+	"slices"
+	"testing"
+	"testing/iotest"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPieceCIDFromInterleavedReaders(t *testing.T) {
+	const stripeSize = 10
+
+	// deal the fixture out in stripes across two readers
+	var stripes [2][]byte
+	for i := 0; i < len(fixture127OfEach0123); i += stripeSize {
+		end := min(i+stripeSize, len(fixture127OfEach0123))
+		stripes[(i/stripeSize)%2] = append(stripes[(i/stripeSize)%2], fixture127OfEach0123[i:end]...)
+	}
+
+	c, paddedSize, err := commcid.PieceCIDFromInterleavedReaders(
+		[]io.Reader{bytes.NewReader(stripes[0]), bytes.NewReader(stripes[1])},
+		stripeSize,
+	)
+	require.NoError(t, err)
+	require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+	require.Equal(t, uint64(512), paddedSize)
+
+	t.Run("error on data past the end of the piece", func(t *testing.T) {
+		_, _, err := commcid.PieceCIDFromInterleavedReaders(
+			[]io.Reader{bytes.NewReader(make([]byte, 200)), bytes.NewReader(make([]byte, 300))},
+			stripeSize,
+		)
+		require.ErrorContains(t, err, "reader 1 holds data past the end of reader 0")
+	})
+}
+
+func TestPieceCIDFromReaderBounded(t *testing.T) {
+	data := bytes.Repeat(fixture127OfEach0123, 100)
+	expected, expectedSize, err := commcid.PieceCIDFromReader(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	for _, budget := range []uint64{4 << 10, 1 << 20} {
+		c, paddedSize, err := commcid.PieceCIDFromReaderBounded(bytes.NewReader(data), budget)
+		require.NoError(t, err)
+		require.Equal(t, expected, c)
+		require.Equal(t, expectedSize, paddedSize)
+	}
+
+	_, _, err = commcid.PieceCIDFromReaderBounded(bytes.NewReader(data), 256)
+	require.ErrorContains(t, err, "memory budget of 256 bytes is below the minimum")
+}
+
+func TestSubPieceCID(t *testing.T) {
+	full := bytes.NewReader(bytes.Repeat(fixture127OfEach0123, 4))
+
+	c, paddedSize, err := commcid.SubPieceCID(full, 508, 508)
+	require.NoError(t, err)
+	require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+	require.Equal(t, uint64(512), paddedSize)
+
+	t.Run("unaligned range", func(t *testing.T) {
+		expected, expectedSize, err := commcid.PieceCIDFromReader(bytes.NewReader(fixture127OfEach0123[100:400]))
+		require.NoError(t, err)
+		c, paddedSize, err := commcid.SubPieceCID(full, 100, 300)
+		require.NoError(t, err)
+		require.Equal(t, expected, c)
+		require.Equal(t, expectedSize, paddedSize)
+	})
+
+	t.Run("error on range past the end", func(t *testing.T) {
+		_, _, err := commcid.SubPieceCID(full, 1900, 200)
+		require.EqualError(t, err, "range ends 68 bytes past the end of the data")
+
+		// too short for a piece as well, but the range is reported first
+		_, _, err = commcid.SubPieceCID(full, 2000, 100)
+		require.EqualError(t, err, "range ends 68 bytes past the end of the data")
+	})
+
+	t.Run("error on short range", func(t *testing.T) {
+		_, _, err := commcid.SubPieceCID(full, 100, 126)
+		require.EqualError(t, err, "invalid range: length 126 is below the minimum piece size of 127 bytes")
+		_, _, err = commcid.SubPieceCID(full, 100, 0)
+		require.EqualError(t, err, "invalid range: length 0 is below the minimum piece size of 127 bytes")
+	})
+}
+
+func TestPieceCIDFromSeeker(t *testing.T) {
+	r := bytes.NewReader(fixture127OfEach0123)
+
+	c, paddedSize, err := commcid.PieceCIDFromSeeker(r)
+	require.NoError(t, err)
+	require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+	require.Equal(t, uint64(512), paddedSize)
+
+	pos, err := r.Seek(0, io.SeekCurrent)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), pos)
+
+	t.Run("hashes from the current position", func(t *testing.T) {
+		r := bytes.NewReader(append(make([]byte, 10), fixture127OfEach0123...))
+		_, err := r.Seek(10, io.SeekStart)
+		require.NoError(t, err)
+
+		c, _, err := commcid.PieceCIDFromSeeker(r)
+		require.NoError(t, err)
+		require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+
+		pos, err := r.Seek(0, io.SeekCurrent)
+		require.NoError(t, err)
+		require.Equal(t, int64(10), pos)
+	})
+}
+
+func TestComparePieceCIDs(t *testing.T) {
+	equal, cidA, cidB, err := commcid.ComparePieceCIDs(bytes.NewReader(fixture127OfEach0123), bytes.NewReader(fixture127OfEach0123))
+	require.NoError(t, err)
+	require.True(t, equal)
+	require.Equal(t, fixture127OfEach0123PieceCID, cidA.String())
+	require.Equal(t, cidA, cidB)
+
+	altered := append([]byte{}, fixture127OfEach0123...)
+	altered[300] ^= 0xff
+	equal, cidA, cidB, err = commcid.ComparePieceCIDs(bytes.NewReader(fixture127OfEach0123), bytes.NewReader(altered))
+	require.NoError(t, err)
+	require.False(t, equal)
+	require.Equal(t, fixture127OfEach0123PieceCID, cidA.String())
+	require.NotEqual(t, cidA, cidB)
+
+	_, _, _, err = commcid.ComparePieceCIDs(bytes.NewReader(fixture127OfEach0123), bytes.NewReader(nil))
+	require.EqualError(t, err, "hashing second input: piece payload must be at least 127 bytes, got 0")
+}
+
+func TestPieceCIDFromRepeatedBlock(t *testing.T) {
+	c, paddedSize, err := commcid.PieceCIDFromRepeatedBlock(fixture127OfEach0123, 1)
+	require.NoError(t, err)
+	require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+	require.Equal(t, uint64(512), paddedSize)
+
+	block := []byte("commcid!")
+	expected, expectedSize, err := commcid.PieceCIDFromReader(bytes.NewReader(bytes.Repeat(block, 1000)))
+	require.NoError(t, err)
+	c, paddedSize, err = commcid.PieceCIDFromRepeatedBlock(block, 1000)
+	require.NoError(t, err)
+	require.Equal(t, expected, c)
+	require.Equal(t, expectedSize, paddedSize)
+
+	_, _, err = commcid.PieceCIDFromRepeatedBlock(block, 0)
+	require.EqualError(t, err, "cannot repeat a 8 byte block 0 times")
+}
+
+func TestPieceCIDFromReaderLimited(t *testing.T) {
+	c, paddedSize, err := commcid.PieceCIDFromReaderLimited(bytes.NewReader(fixture127OfEach0123), 508)
+	require.NoError(t, err)
+	require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+	require.Equal(t, uint64(512), paddedSize)
+
+	r := bytes.NewReader(bytes.Repeat(fixture127OfEach0123, 1000))
+	_, _, err = commcid.PieceCIDFromReaderLimited(r, 507)
+	require.ErrorIs(t, err, commcid.ErrPieceTooLarge)
+	require.Equal(t, int64(508), r.Size()-int64(r.Len()))
+}
+
+func TestPrefixPieceCID(t *testing.T) {
+	r := bytes.NewReader(bytes.Repeat(fixture127OfEach0123, 3))
+	c, paddedSize, err := commcid.PrefixPieceCID(r, 508)
+	require.NoError(t, err)
+	require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+	require.Equal(t, uint64(512), paddedSize)
+	require.Equal(t, int64(508), r.Size()-int64(r.Len()))
+
+	_, _, err = commcid.PrefixPieceCID(bytes.NewReader(fixture127OfEach0123), 600)
+	require.EqualError(t, err, "data ended after 508 bytes, before the 600 byte prefix")
+}
+
+func TestPieceCIDWithBlockOffsets(t *testing.T) {
+	c, paddedSize, offsets, err := commcid.PieceCIDWithBlockOffsets(bytes.NewReader(fixture127OfEach0123), []uint64{0, 127, 200, 381, 508})
+	require.NoError(t, err)
+	require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+	require.Equal(t, uint64(512), paddedSize)
+	// 200 is 73 bytes into the second chunk: two full field elements plus 76 bits
+	require.Equal(t, []uint64{0, 128, 201, 384, 512}, offsets)
+
+	t.Run("error on descending boundaries", func(t *testing.T) {
+		_, _, _, err := commcid.PieceCIDWithBlockOffsets(bytes.NewReader(fixture127OfEach0123), []uint64{127, 100})
+		require.EqualError(t, err, "block boundary 1 at offset 100 precedes the previous boundary at 127")
+	})
+
+	t.Run("error on boundary past the data", func(t *testing.T) {
+		_, _, _, err := commcid.PieceCIDWithBlockOffsets(bytes.NewReader(fixture127OfEach0123), []uint64{509})
+		require.EqualError(t, err, "block boundary at offset 509 is past the end of the 508 byte data")
+	})
+}
+
+func TestPieceCIDFromReaderChan(t *testing.T) {
+	progress, result := commcid.PieceCIDFromReaderChan(bytes.NewReader(fixture127OfEach0123))
+	for range progress {
+	}
+	res := <-result
+	require.NoError(t, res.Err)
+	require.Equal(t, fixture127OfEach0123PieceCID, res.CID.String())
+	require.Equal(t, uint64(512), res.PaddedSize)
+
+	t.Run("progress is monotonic", func(t *testing.T) {
+		data := bytes.Repeat(fixture127OfEach0123, 2048)
+		expected, expectedSize, err := commcid.PieceCIDFromReader(bytes.NewReader(data))
+		require.NoError(t, err)
+
+		progress, result := commcid.PieceCIDFromReaderChan(bytes.NewReader(data))
+		var last uint64
+		for processed := range progress {
+			require.Greater(t, processed, last)
+			require.LessOrEqual(t, processed, uint64(len(data)))
+			last = processed
+		}
+		res := <-result
+		require.NoError(t, res.Err)
+		require.Equal(t, expected, res.CID)
+		require.Equal(t, expectedSize, res.PaddedSize)
+	})
+
+	t.Run("error on payload below minimum size", func(t *testing.T) {
+		_, result := commcid.PieceCIDFromReaderChan(bytes.NewReader(make([]byte, 126)))
+		require.EqualError(t, (<-result).Err, "piece payload must be at least 127 bytes, got 126")
+	})
+}
+
+func TestPieceCIDFromReaderDetectZero(t *testing.T) {
+	c, paddedSize, isZero, err := commcid.PieceCIDFromReaderDetectZero(bytes.NewReader(make([]byte, 127*16)))
+	require.NoError(t, err)
+	require.True(t, isZero)
+	require.Equal(t, "baga6ea4seaqpy7usqklokfx2vxuynmupslkeutzexe2uqurdg5vhtebhxqmpqmy", c.String())
+	require.Equal(t, uint64(2048), paddedSize)
+
+	c, paddedSize, isZero, err = commcid.PieceCIDFromReaderDetectZero(bytes.NewReader(fixture127OfEach0123))
+	require.NoError(t, err)
+	require.False(t, isZero)
+	require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+	require.Equal(t, uint64(512), paddedSize)
+}
+
+func TestPieceCIDFromReaderBigEndianFE(t *testing.T) {
+	data := make([]byte, 1024)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	swapped := slices.Clone(data)
+	for i := 0; i < len(swapped); i += 32 {
+		slices.Reverse(swapped[i : i+32])
+	}
+
+	c, paddedSize, err := commcid.PieceCIDFromReaderBigEndianFE(bytes.NewReader(data))
+	require.NoError(t, err)
+	expected, expectedSize, err := commcid.PieceCIDFromReader(bytes.NewReader(swapped))
+	require.NoError(t, err)
+	require.Equal(t, expected, c)
+	require.Equal(t, expectedSize, paddedSize)
+
+	unswapped, _, err := commcid.PieceCIDFromReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.NotEqual(t, unswapped, c)
+
+	t.Run("error on partial field element", func(t *testing.T) {
+		_, _, err := commcid.PieceCIDFromReaderBigEndianFE(bytes.NewReader(data[:1000]))
+		require.ErrorContains(t, err, "data ends with a partial field element of 8 bytes")
+	})
+}
+
+func TestPieceCIDFromReaderAligned(t *testing.T) {
+	c, paddedSize, err := commcid.PieceCIDFromReaderAligned(bytes.NewReader(fixture127OfEach0123), 127)
+	require.NoError(t, err)
+	require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+	require.Equal(t, uint64(512), paddedSize)
+
+	t.Run("error on misaligned data", func(t *testing.T) {
+		_, _, err := commcid.PieceCIDFromReaderAligned(bytes.NewReader(fixture127OfEach0123), 256)
+		require.EqualError(t, err, "data size 508 is not a multiple of the 256 byte block size, expected 256 or 512")
+	})
+
+	t.Run("error on zero block size", func(t *testing.T) {
+		_, _, err := commcid.PieceCIDFromReaderAligned(bytes.NewReader(fixture127OfEach0123), 0)
+		require.EqualError(t, err, "block size must be positive")
+	})
+}
+
+func TestPieceCIDWithFieldStats(t *testing.T) {
+	data := make([]byte, 1030)
+	data[31] = 0xff
+	data[63] = 0x40
+	data[95] = 0x3f
+	data[1023] = 0x80
+	// the trailing six bytes are a partial word and are not counted
+	data[1029] = 0xff
+
+	c, paddedSize, highBitWords, err := commcid.PieceCIDWithFieldStats(iotest.OneByteReader(bytes.NewReader(data)))
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), highBitWords)
+
+	expected, expectedSize, err := commcid.PieceCIDFromReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, expected, c)
+	require.Equal(t, expectedSize, paddedSize)
+
+	_, _, highBitWords, err = commcid.PieceCIDWithFieldStats(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), highBitWords)
+
+	t.Run("pre-packed data has no high bit words", func(t *testing.T) {
+		packed := bytes.Repeat([]byte{0xff}, 1024)
+		for i := 32 - 1; i < len(packed); i += 32 {
+			packed[i] = 0x3f
+		}
+		_, _, highBitWords, err := commcid.PieceCIDWithFieldStats(bytes.NewReader(packed))
+		require.NoError(t, err)
+		require.Zero(t, highBitWords)
+	})
+}
+
+func TestPieceCIDFromReaderWithMD5(t *testing.T) {
+	sum := md5.Sum(fixture127OfEach0123)
+	expectedMD5 := base64.StdEncoding.EncodeToString(sum[:])
+
+	c, paddedSize, err := commcid.PieceCIDFromReaderWithMD5(bytes.NewReader(fixture127OfEach0123), expectedMD5)
+	require.NoError(t, err)
+	require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+	require.Equal(t, uint64(512), paddedSize)
+
+	t.Run("error on MD5 mismatch", func(t *testing.T) {
+		zeroSum := md5.Sum(make([]byte, len(fixture127OfEach0123)))
+		wrongMD5 := base64.StdEncoding.EncodeToString(zeroSum[:])
+		_, _, err := commcid.PieceCIDFromReaderWithMD5(bytes.NewReader(fixture127OfEach0123), wrongMD5)
+		require.EqualError(t, err, "MD5 mismatch: expected "+wrongMD5+", got "+expectedMD5)
+	})
+}
+
+func TestPieceCIDFromReaderExpectSize(t *testing.T) {
+	c, paddedSize, err := commcid.PieceCIDFromReaderExpectSize(bytes.NewReader(fixture127OfEach0123), 508)
+	require.NoError(t, err)
+	require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+	require.Equal(t, uint64(512), paddedSize)
+
+	t.Run("error on short stream", func(t *testing.T) {
+		_, _, err := commcid.PieceCIDFromReaderExpectSize(bytes.NewReader(fixture127OfEach0123[:500]), 508)
+		require.ErrorIs(t, err, commcid.ErrSizeMismatch)
+		require.EqualError(t, err, "data ended after 500 of 508 declared bytes: piece data size does not match declared size")
+	})
+
+	t.Run("error on long stream", func(t *testing.T) {
+		r := bytes.NewReader(append(fixture127OfEach0123, make([]byte, 1000)...))
+		_, _, err := commcid.PieceCIDFromReaderExpectSize(r, 508)
+		require.ErrorIs(t, err, commcid.ErrSizeMismatch)
+		require.EqualError(t, err, "data continues past 508 declared bytes: piece data size does not match declared size")
+		require.Equal(t, 999, r.Len())
+	})
+
+	t.Run("error on invalid declared size", func(t *testing.T) {
+		_, _, err := commcid.PieceCIDFromReaderExpectSize(bytes.NewReader(fixture127OfEach0123), 100)
+		require.EqualError(t, err, "unpadded piece size must be at least 127 bytes, got 100")
+	})
+}
@@ -0,0 +1,35 @@
+package commcid
+
+import (
+	"io"
+
+	"github.com/ipfs/go-cid"
+)
+
+// PieceReceipt is the result of hashing a piece for a deal, in the shape deal
+// services return to clients
+type PieceReceipt struct {
+	PieceCID   cid.Cid `json:"pieceCid"`
+	PaddedSize uint64  `json:"paddedSize"`
+	RawSize    uint64  `json:"rawSize"`
+	DealID     string  `json:"dealId"`
+}
+
+// GeneratePieceReceipt computes the v1 piece CID, padded piece size and raw
+// size of all data read from r and returns them in a receipt for dealID
+func GeneratePieceReceipt(r io.Reader, dealID string) (PieceReceipt, error) {
+	commP, unpaddedSize, paddedSize, err := DataCommitmentV1FromReader(r)
+	if err != nil {
+		return PieceReceipt{}, err
+	}
+	c, err := PieceCommitmentV1ToCID(commP)
+	if err != nil {
+		return PieceReceipt{}, err
+	}
+	return PieceReceipt{
+		PieceCID:   c,
+		PaddedSize: paddedSize,
+		RawSize:    unpaddedSize,
+		DealID:     dealID,
+	}, nil
+}
@@ -0,0 +1,32 @@
+package commcid_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeneratePieceReceipt(t *testing.T) {
+	receipt, err := commcid.GeneratePieceReceipt(bytes.NewReader(fixture127OfEach0123), "deal-1")
+	require.NoError(t, err)
+	require.Equal(t, fixture127OfEach0123PieceCID, receipt.PieceCID.String())
+	require.Equal(t, uint64(512), receipt.PaddedSize)
+	require.Equal(t, uint64(508), receipt.RawSize)
+	require.Equal(t, "deal-1", receipt.DealID)
+
+	raw, err := json.Marshal(receipt)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"pieceCid":{"/":"`+fixture127OfEach0123PieceCID+`"},"paddedSize":512,"rawSize":508,"dealId":"deal-1"}`, string(raw))
+
+	var decoded commcid.PieceReceipt
+	require.NoError(t, json.Unmarshal(raw, &decoded))
+	require.Equal(t, receipt, decoded)
+
+	t.Run("error on payload below minimum size", func(t *testing.T) {
+		_, err := commcid.GeneratePieceReceipt(bytes.NewReader(make([]byte, 126)), "deal-1")
+		require.EqualError(t, err, "piece payload must be at least 127 bytes, got 126")
+	})
+}
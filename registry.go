@@ -0,0 +1,74 @@
+package commcid
+
+import (
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// CommitmentRegistry is a concurrency-safe set of known commitments. A v1 CID
+// matches any added CID with the same commitment. A v2 piece CID also matches
+// on the commitment alone while only v1 CIDs of it were added, but once a v2
+// piece CID of a commitment is added, other v2 piece CIDs of that commitment
+// only match if their size was added too. The zero value is an empty registry
+// ready to use.
+type CommitmentRegistry struct {
+	mu sync.RWMutex
+	// known maps each folded CommitmentKey to whether a v2 size was added
+	known map[[40]byte]bool
+	// sized holds the full CommitmentKey of every v2 piece CID added
+	sized map[[40]byte]struct{}
+}
+
+// Add records the commitment carried by c, which must be a data, replica or
+// v2 piece CID
+func (r *CommitmentRegistry) Add(c cid.Cid) error {
+	key, err := CommitmentKey(c)
+	if err != nil {
+		return err
+	}
+	folded := foldCommitmentKey(key)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.known == nil {
+		r.known = make(map[[40]byte]bool)
+		r.sized = make(map[[40]byte]struct{})
+	}
+	if key != folded {
+		r.known[folded] = true
+		r.sized[key] = struct{}{}
+	} else if !r.known[folded] {
+		r.known[folded] = false
+	}
+	return nil
+}
+
+// Contains reports whether the commitment carried by c has been added. It is
+// false for CIDs that are not commitments.
+func (r *CommitmentRegistry) Contains(c cid.Cid) bool {
+	return r.Validate(c) == nil
+}
+
+// Validate returns an error unless c is a commitment CID whose commitment has
+// been added, with its size too if c is a v2 piece CID and a v2 piece CID of
+// the same commitment was added
+func (r *CommitmentRegistry) Validate(c cid.Cid) error {
+	key, err := CommitmentKey(c)
+	if err != nil {
+		return err
+	}
+	folded := foldCommitmentKey(key)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	hasSizes, ok := r.known[folded]
+	if !ok {
+		return xerrors.Errorf("commitment %s is not in the registry", c)
+	}
+	if key != folded && hasSizes {
+		if _, ok := r.sized[key]; !ok {
+			return xerrors.Errorf("piece CID %s has a size that is not in the registry", c)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package commcid_test
+
+import (
+	"sync"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitmentRegistry(t *testing.T) {
+	var registry commcid.CommitmentRegistry
+	require.NoError(t, registry.Add(cid.MustParse(fixture32GiBEmptyV1)))
+
+	require.True(t, registry.Contains(cid.MustParse(fixture32GiBEmptyV1)))
+	require.True(t, registry.Contains(cid.MustParse(fixture32GiBEmptyV2)))
+	require.NoError(t, registry.Validate(cid.MustParse(fixture32GiBEmptyV2)))
+
+	require.False(t, registry.Contains(cid.MustParse(fixture127OfEach0123PieceCID)))
+	require.EqualError(t, registry.Validate(cid.MustParse(fixture127OfEach0123PieceCID)), "commitment "+fixture127OfEach0123PieceCID+" is not in the registry")
+
+	t.Run("replica commitments are distinct from data commitments", func(t *testing.T) {
+		commD, err := commcid.CIDToPieceCommitmentV1(cid.MustParse(fixture32GiBEmptyV1))
+		require.NoError(t, err)
+		commR, err := commcid.ReplicaCommitmentV1ToCID(commD)
+		require.NoError(t, err)
+		require.False(t, registry.Contains(commR))
+	})
+
+	t.Run("v2 piece CIDs must match an added size", func(t *testing.T) {
+		plus4, plus5 := cid.MustParse(fixture127Plus4ZerosPieceCID), cid.MustParse(fixture127Plus5ZerosPieceCID)
+		v1, _, err := commcid.ConvertDataCommitmentV1PieceMhCIDToV1CID(plus4)
+		require.NoError(t, err)
+
+		var registry commcid.CommitmentRegistry
+		require.NoError(t, registry.Add(plus4))
+		require.True(t, registry.Contains(plus4))
+		require.True(t, registry.Contains(v1))
+		require.False(t, registry.Contains(plus5))
+		require.EqualError(t, registry.Validate(plus5), "piece CID "+fixture127Plus5ZerosPieceCID+" has a size that is not in the registry")
+
+		// adding the v1 CID does not lift the size check
+		require.NoError(t, registry.Add(v1))
+		require.False(t, registry.Contains(plus5))
+
+		require.NoError(t, registry.Add(plus5))
+		require.True(t, registry.Contains(plus5))
+	})
+
+	t.Run("error on non-commitment CID", func(t *testing.T) {
+		require.ErrorIs(t, registry.Add(cid.MustParse("bafkqaaa")), commcid.ErrIncorrectCodec)
+		require.False(t, registry.Contains(cid.MustParse("bafkqaaa")))
+	})
+
+	t.Run("concurrent use", func(t *testing.T) {
+		var registry commcid.CommitmentRegistry
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				require.NoError(t, registry.Add(cid.MustParse(fixture127OfEach0123PieceCID)))
+				require.True(t, registry.Contains(cid.MustParse(fixture127OfEach0123PieceCID)))
+			}()
+		}
+		wg.Wait()
+	})
+}
@@ -0,0 +1,82 @@
+package commcid
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// PieceSidecar is the cached result of hashing a piece, stored as JSON next
+// to the data it describes
+type PieceSidecar struct {
+	PieceCID      string    `json:"pieceCid"`
+	PaddedSize    uint64    `json:"paddedSize"`
+	SourceSize    uint64    `json:"sourceSize"`
+	SourceModTime time.Time `json:"sourceModTime"`
+	ComputedAt    time.Time `json:"computedAt"`
+}
+
+// PieceCIDToSidecar computes the v1 piece CID and padded piece size of the file
+// at dataPath and records them, along with the size and modification time of
+// the file, as a JSON sidecar at sidecarPath
+func PieceCIDToSidecar(dataPath, sidecarPath string) (cid.Cid, uint64, error) {
+	f, err := os.Open(dataPath)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+
+	c, paddedSize, err := PieceCIDFromReader(f)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+
+	out, err := json.Marshal(PieceSidecar{
+		PieceCID:      c.String(),
+		PaddedSize:    paddedSize,
+		SourceSize:    uint64(info.Size()),
+		SourceModTime: info.ModTime().UTC(),
+		ComputedAt:    time.Now().UTC(),
+	})
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	if err := os.WriteFile(sidecarPath, out, 0644); err != nil {
+		return cid.Undef, 0, xerrors.Errorf("writing sidecar: %w", err)
+	}
+	return c, paddedSize, nil
+}
+
+// PieceCIDFromSidecar reads the piece CID and padded piece size cached in the
+// sidecar at sidecarPath. valid reports whether the file at dataPath still has
+// the size and modification time recorded in the sidecar; if it does not, the
+// cached values are stale and the piece should be hashed again.
+func PieceCIDFromSidecar(dataPath, sidecarPath string) (cid.Cid, uint64, bool, error) {
+	raw, err := os.ReadFile(sidecarPath)
+	if err != nil {
+		return cid.Undef, 0, false, err
+	}
+	var sidecar PieceSidecar
+	if err := json.Unmarshal(raw, &sidecar); err != nil {
+		return cid.Undef, 0, false, xerrors.Errorf("Error decoding sidecar: %w", err)
+	}
+	c, err := cid.Decode(sidecar.PieceCID)
+	if err != nil {
+		return cid.Undef, 0, false, xerrors.Errorf("Error decoding sidecar piece CID: %w", err)
+	}
+
+	info, err := os.Stat(dataPath)
+	if err != nil {
+		return cid.Undef, 0, false, err
+	}
+	valid := uint64(info.Size()) == sidecar.SourceSize && info.ModTime().Equal(sidecar.SourceModTime)
+	return c, sidecar.PaddedSize, valid, nil
+}
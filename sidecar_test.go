@@ -0,0 +1,74 @@
+package commcid_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPieceCIDToSidecar(t *testing.T) {
+	dir := t.TempDir()
+	dataPath := filepath.Join(dir, "piece.bin")
+	sidecarPath := filepath.Join(dir, "piece.bin.commp.json")
+	require.NoError(t, os.WriteFile(dataPath, fixture127OfEach0123, 0644))
+
+	c, paddedSize, err := commcid.PieceCIDToSidecar(dataPath, sidecarPath)
+	require.NoError(t, err)
+	require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+	require.Equal(t, uint64(512), paddedSize)
+
+	raw, err := os.ReadFile(sidecarPath)
+	require.NoError(t, err)
+	var sidecar commcid.PieceSidecar
+	require.NoError(t, json.Unmarshal(raw, &sidecar))
+	require.Equal(t, fixture127OfEach0123PieceCID, sidecar.PieceCID)
+	require.Equal(t, uint64(512), sidecar.PaddedSize)
+	require.Equal(t, uint64(len(fixture127OfEach0123)), sidecar.SourceSize)
+	require.False(t, sidecar.ComputedAt.IsZero())
+
+	t.Run("error on missing data file", func(t *testing.T) {
+		_, _, err := commcid.PieceCIDToSidecar(filepath.Join(dir, "missing"), sidecarPath)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestPieceCIDFromSidecar(t *testing.T) {
+	dir := t.TempDir()
+	dataPath := filepath.Join(dir, "piece.bin")
+	sidecarPath := filepath.Join(dir, "piece.bin.commp.json")
+	require.NoError(t, os.WriteFile(dataPath, fixture127OfEach0123, 0644))
+
+	_, _, err := commcid.PieceCIDToSidecar(dataPath, sidecarPath)
+	require.NoError(t, err)
+
+	c, paddedSize, valid, err := commcid.PieceCIDFromSidecar(dataPath, sidecarPath)
+	require.NoError(t, err)
+	require.True(t, valid)
+	require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+	require.Equal(t, uint64(512), paddedSize)
+
+	t.Run("invalid after source modification time changes", func(t *testing.T) {
+		info, err := os.Stat(dataPath)
+		require.NoError(t, err)
+		later := info.ModTime().Add(time.Minute)
+		require.NoError(t, os.Chtimes(dataPath, later, later))
+
+		_, _, valid, err := commcid.PieceCIDFromSidecar(dataPath, sidecarPath)
+		require.NoError(t, err)
+		require.False(t, valid)
+	})
+
+	t.Run("invalid after source content changes", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(dataPath, fixture127OfEach0123[:300], 0644))
+
+		c, _, valid, err := commcid.PieceCIDFromSidecar(dataPath, sidecarPath)
+		require.NoError(t, err)
+		require.False(t, valid)
+		require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+	})
+}
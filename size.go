@@ -0,0 +1,254 @@
+package commcid
+
+import (
+	"math"
+	"math/bits"
+	"slices"
+
+	"github.com/ipfs/go-cid"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// MinUnpaddedPieceSize is the smallest amount of raw data that can form a
+	// piece: one 127 byte chunk, which pads to the smallest 128 byte tree
+	MinUnpaddedPieceSize = fr32UnpaddedChunk
+	// MaxUnpaddedPieceSize is the largest amount of raw data that fits in a
+	// piece, the capacity of the tallest tree whose padded size (2^63 bytes)
+	// still fits in a uint64
+	MaxUnpaddedPieceSize = nodeSize << maxTreeHeight / fr32PaddedChunk * fr32UnpaddedChunk
+)
+
+// unpaddedCapacity returns how many raw bytes a tree of the given height can
+// hold; heights below 2 cannot hold a full 127 byte chunk and have no capacity
+func unpaddedCapacity(height uint8) uint64 {
+	return (nodeSize << height) / fr32PaddedChunk * fr32UnpaddedChunk
+}
+
+// validatePayloadSize returns an error if no piece can hold exactly this many
+// raw bytes
+func validatePayloadSize(unpadded uint64) error {
+	if unpadded < MinUnpaddedPieceSize {
+		return xerrors.Errorf("unpadded piece size must be at least %d bytes, got %d", MinUnpaddedPieceSize, unpadded)
+	}
+	if unpadded > MaxUnpaddedPieceSize {
+		return xerrors.Errorf("unpadded piece size must be at most %d bytes, got %d", MaxUnpaddedPieceSize, unpadded)
+	}
+	return nil
+}
+
+// IsExactPowerOfTwoPiece reports whether the given amount of raw data exactly
+// fills a tree once FR32 padded, so that no zero padding is needed, and
+// returns the height of that tree
+func IsExactPowerOfTwoPiece(unpadded uint64) (bool, uint8, error) {
+	if err := validatePayloadSize(unpadded); err != nil {
+		return false, 0, err
+	}
+	height := paddedTreeHeight(unpadded)
+	if unpadded != unpaddedCapacity(height) {
+		return false, 0, nil
+	}
+	return true, height, nil
+}
+
+// Fr32PaddedSizeToV1TreeHeight returns the height of the smallest tree able to
+// hold the given amount of FR32 padded data
+func Fr32PaddedSizeToV1TreeHeight(size uint64) uint8 {
+	if size <= nodeSize {
+		return 0
+	}
+	return uint8(bits.Len64((size - 1) / nodeSize))
+}
+
+// PaddedSizeToV1TreeHeight returns the height of the tree whose padded size is
+// exactly paddedSize, which must be 32 times a power of two
+func PaddedSizeToV1TreeHeight(paddedSize uint64) (uint8, error) {
+	if paddedSize < nodeSize || paddedSize&(paddedSize-1) != 0 {
+		return 0, xerrors.Errorf("padded size %d must be a power of two between %d and %d", paddedSize, nodeSize, uint64(nodeSize)<<maxTreeHeight)
+	}
+	return uint8(bits.TrailingZeros64(paddedSize / nodeSize)), nil
+}
+
+// UnpaddedSizeToV1TreeHeight returns the height of the tree that the given
+// amount of unpadded data occupies once FR32 padded
+func UnpaddedSizeToV1TreeHeight(unpaddedDataSize uint64) (uint8, error) {
+	if err := validatePayloadSize(unpaddedDataSize); err != nil {
+		return 0, err
+	}
+	return paddedTreeHeight(unpaddedDataSize), nil
+}
+
+// NextPaddedPieceSize returns the smallest padded piece size able to hold the
+// given amount of unpadded data once FR32 padded, which is 32 << H for the
+// tree height H that UnpaddedSizeToV1TreeHeight returns
+func NextPaddedPieceSize(unpaddedSize uint64) (uint64, error) {
+	height, err := UnpaddedSizeToV1TreeHeight(unpaddedSize)
+	if err != nil {
+		return 0, err
+	}
+	return nodeSize << height, nil
+}
+
+// V1TreeHeightToMaxUnpaddedSize returns the largest amount of unpadded data a
+// tree of the given height can hold, the inverse of UnpaddedSizeToV1TreeHeight.
+//
+// Heights 0 and 1 are a special case: they are too small for a full 127 byte
+// chunk, so no piece built by this package has them, and the size returned is
+// the whole bytes their 254 bit leaves can carry (31 bytes for a single leaf,
+// 63 for two). Heights whose padded size does not fit in a uint64 return 0.
+func V1TreeHeightToMaxUnpaddedSize(height uint8) uint64 {
+	switch {
+	case height > maxTreeHeight:
+		return 0
+	case height < 2:
+		return (uint64(1) << height) * 254 / 8
+	default:
+		return unpaddedCapacity(height)
+	}
+}
+
+// V1TreeHeightToPaddedSize returns the padded size of a tree of the given
+// height, or 0 if it does not fit in a uint64
+func V1TreeHeightToPaddedSize(height uint8) uint64 {
+	if height > maxTreeHeight {
+		return 0
+	}
+	return nodeSize << height
+}
+
+// SizeLayout describes the tree a piece of a given unpadded size occupies
+type SizeLayout struct {
+	// TreeHeight is the height of the smallest tree holding the data once
+	// FR32 padded
+	TreeHeight uint8
+	// Padding is the number of unpadded zero bytes appended to the data to
+	// fill the tree
+	Padding uint64
+	// PaddedSize is the size of the tree in bytes, 32 << TreeHeight
+	PaddedSize uint64
+	// UnpaddedCapacity is how many unpadded bytes the tree holds, the data
+	// size plus Padding
+	UnpaddedCapacity uint64
+}
+
+// ComputeV1SizeLayout returns the layout of the tree holding the given amount
+// of unpadded data
+func ComputeV1SizeLayout(unpaddedSize uint64) (SizeLayout, error) {
+	height, err := UnpaddedSizeToV1TreeHeight(unpaddedSize)
+	if err != nil {
+		return SizeLayout{}, err
+	}
+	capacity := unpaddedCapacity(height)
+	return SizeLayout{
+		TreeHeight:       height,
+		Padding:          capacity - unpaddedSize,
+		PaddedSize:       nodeSize << height,
+		UnpaddedCapacity: capacity,
+	}, nil
+}
+
+// UnpaddedSizeToV1TreeHeightAndPadding returns the tree height for the given
+// amount of unpadded data, together with the number of unpadded zero bytes
+// needed to fill that tree
+func UnpaddedSizeToV1TreeHeightAndPadding(unpaddedDataSize uint64) (uint8, uint64, error) {
+	layout, err := ComputeV1SizeLayout(unpaddedDataSize)
+	if err != nil {
+		return 0, 0, err
+	}
+	return layout.TreeHeight, layout.Padding, nil
+}
+
+// UnpaddedSizeToV1Padding returns just the number of unpadded zero bytes needed
+// to fill the tree holding the given amount of unpadded data, as computed by
+// UnpaddedSizeToV1TreeHeightAndPadding
+func UnpaddedSizeToV1Padding(unpaddedDataSize uint64) (uint64, error) {
+	_, padding, err := UnpaddedSizeToV1TreeHeightAndPadding(unpaddedDataSize)
+	return padding, err
+}
+
+// validatePaddedSize returns an error unless the size is that of a full tree
+// able to hold at least one FR32 padded chunk
+func validatePaddedSize(padded uint64) error {
+	if padded < fr32PaddedChunk || padded&(padded-1) != 0 || padded > nodeSize<<maxTreeHeight {
+		return xerrors.Errorf("padded piece size %d must be a power of two between %d and %d", padded, fr32PaddedChunk, uint64(nodeSize)<<maxTreeHeight)
+	}
+	return nil
+}
+
+// WouldCrossHeightBoundary reports whether adding addBytes of unpadded data to
+// a piece currently holding currentUnpadded bytes grows its tree, along with
+// the tree heights before and after
+func WouldCrossHeightBoundary(currentUnpadded, addBytes uint64) (bool, uint8, uint8, error) {
+	before, err := UnpaddedSizeToV1TreeHeight(currentUnpadded)
+	if err != nil {
+		return false, 0, 0, err
+	}
+	if addBytes > MaxUnpaddedPieceSize-currentUnpadded {
+		return false, 0, 0, xerrors.Errorf("adding %d bytes exceeds the maximum piece size", addBytes)
+	}
+	after, err := UnpaddedSizeToV1TreeHeight(currentUnpadded + addBytes)
+	if err != nil {
+		return false, 0, 0, err
+	}
+	return after > before, before, after, nil
+}
+
+// paddedOffset maps an offset into the raw data to the offset of the byte
+// holding the same bit once the data is FR32 padded
+func paddedOffset(unpadded uint64) uint64 {
+	chunks, rem := unpadded/fr32UnpaddedChunk, unpadded%fr32UnpaddedChunk
+	// each 254 bits of a chunk are followed by two padding bits
+	bit := rem * 8
+	return chunks*fr32PaddedChunk + bit/254*nodeSize + bit%254/8
+}
+
+// UnpaddedSizeToPaddedSize returns how many bytes the given amount of raw
+// data occupies once FR32 padded at the 127 to 128 ratio. A trailing partial
+// chunk is zero-filled to a whole chunk first, as the hasher does, and zero
+// bytes pad to zero. Sizes too large for the result to fit return
+// math.MaxUint64.
+func UnpaddedSizeToPaddedSize(unpadded uint64) uint64 {
+	chunks := unpadded / fr32UnpaddedChunk
+	if unpadded%fr32UnpaddedChunk != 0 {
+		chunks++
+	}
+	if chunks > math.MaxUint64/fr32PaddedChunk {
+		return math.MaxUint64
+	}
+	return chunks * fr32PaddedChunk
+}
+
+// PaddedSizeToUnpaddedSize returns how many raw bytes expand to the given
+// amount of FR32 padded data, which must be a multiple of 128. Zero padded
+// bytes hold zero raw bytes.
+func PaddedSizeToUnpaddedSize(padded uint64) (uint64, error) {
+	if padded%fr32PaddedChunk != 0 {
+		return 0, xerrors.Errorf("padded size %d is not a multiple of %d", padded, fr32PaddedChunk)
+	}
+	return padded / fr32PaddedChunk * fr32UnpaddedChunk, nil
+}
+
+// Fr32OverheadBytes returns how many bytes of the padded piece holding the
+// given amount of raw data are taken up by FR32 expansion, two bits for every
+// 254. This is the padded size less the tree's unpadded capacity, and excludes
+// the zero padding that fills the unused remainder of the tree.
+func Fr32OverheadBytes(unpadded uint64) (uint64, error) {
+	if err := validatePayloadSize(unpadded); err != nil {
+		return 0, err
+	}
+	height := paddedTreeHeight(unpadded)
+	return nodeSize<<height - unpaddedCapacity(height), nil
+}
+
+// PossiblePaddedSizesForV1CID returns the standard sector sizes that the piece
+// committed to by the v1 piece CID c could have. A v1 piece CID carries only
+// the root of the tree and not its height, so the commitment alone can never
+// pin down the size: every standard size is returned for any valid CID, and
+// callers need the size from elsewhere (or a v2 piece CID) to narrow it down.
+func PossiblePaddedSizesForV1CID(c cid.Cid) ([]uint64, error) {
+	if _, err := CIDToPieceCommitmentV1(c); err != nil {
+		return nil, err
+	}
+	return slices.Clone(standardSectorSizes), nil
+}
@@ -0,0 +1,289 @@
+package commcid_test
+
+import (
+	"math"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsExactPowerOfTwoPiece(t *testing.T) {
+	testCases := []struct {
+		unpadded uint64
+		exact    bool
+		height   uint8
+	}{
+		{127, true, 2},
+		{127 * 4, true, 4},
+		{512, false, 0},
+		{127*4 - 1, false, 0},
+		{32 << 30 / 128 * 127, true, 30},
+	}
+	for _, tc := range testCases {
+		exact, height, err := commcid.IsExactPowerOfTwoPiece(tc.unpadded)
+		require.NoError(t, err)
+		require.Equal(t, tc.exact, exact, "size %d", tc.unpadded)
+		require.Equal(t, tc.height, height, "size %d", tc.unpadded)
+	}
+
+	_, _, err := commcid.IsExactPowerOfTwoPiece(126)
+	require.EqualError(t, err, "unpadded piece size must be at least 127 bytes, got 126")
+}
+
+func TestUnpaddedSizeToV1TreeHeightAndPadding(t *testing.T) {
+	testCases := []struct {
+		unpadded uint64
+		height   uint8
+		padding  uint64
+	}{
+		{127, 2, 0},
+		{128, 3, 126},
+		{127 * 4, 4, 0},
+		{127*4 + 1, 5, 127*4 - 1},
+		{32 << 30 / 128 * 127, 30, 0},
+	}
+	for _, tc := range testCases {
+		height, padding, err := commcid.UnpaddedSizeToV1TreeHeightAndPadding(tc.unpadded)
+		require.NoError(t, err)
+		require.Equal(t, tc.height, height, "size %d", tc.unpadded)
+		require.Equal(t, tc.padding, padding, "size %d", tc.unpadded)
+	}
+
+	_, _, err := commcid.UnpaddedSizeToV1TreeHeightAndPadding(126)
+	require.EqualError(t, err, "unpadded piece size must be at least 127 bytes, got 126")
+
+	_, _, err = commcid.UnpaddedSizeToV1TreeHeightAndPadding(1 << 63)
+	require.EqualError(t, err, "unpadded piece size must be at most 9151314442816847872 bytes, got 9223372036854775808")
+}
+
+func TestUnpaddedPieceSizeLimits(t *testing.T) {
+	require.Equal(t, uint64(127), uint64(commcid.MinUnpaddedPieceSize))
+	require.Equal(t, uint64(9151314442816847872), uint64(commcid.MaxUnpaddedPieceSize))
+	require.Equal(t, uint64(commcid.MaxUnpaddedPieceSize), commcid.V1TreeHeightToMaxUnpaddedSize(58))
+
+	height, padding, err := commcid.UnpaddedSizeToV1TreeHeightAndPadding(commcid.MinUnpaddedPieceSize)
+	require.NoError(t, err)
+	require.Equal(t, uint8(2), height)
+	require.Zero(t, padding)
+	_, _, err = commcid.UnpaddedSizeToV1TreeHeightAndPadding(commcid.MinUnpaddedPieceSize - 1)
+	require.EqualError(t, err, "unpadded piece size must be at least 127 bytes, got 126")
+
+	height, padding, err = commcid.UnpaddedSizeToV1TreeHeightAndPadding(commcid.MaxUnpaddedPieceSize)
+	require.NoError(t, err)
+	require.Equal(t, uint8(58), height)
+	require.Zero(t, padding)
+	_, _, err = commcid.UnpaddedSizeToV1TreeHeightAndPadding(commcid.MaxUnpaddedPieceSize + 1)
+	require.EqualError(t, err, "unpadded piece size must be at most 9151314442816847872 bytes, got 9151314442816847873")
+}
+
+func TestComputeV1SizeLayout(t *testing.T) {
+	layout, err := commcid.ComputeV1SizeLayout(1000)
+	require.NoError(t, err)
+	require.Equal(t, commcid.SizeLayout{TreeHeight: 5, Padding: 16, PaddedSize: 1024, UnpaddedCapacity: 1016}, layout)
+
+	layout, err = commcid.ComputeV1SizeLayout(fixture32GiBUnpadded)
+	require.NoError(t, err)
+	require.Equal(t, commcid.SizeLayout{TreeHeight: 30, PaddedSize: 32 << 30, UnpaddedCapacity: fixture32GiBUnpadded}, layout)
+
+	for _, unpadded := range []uint64{127, 128, 509, 1 << 40} {
+		layout, err := commcid.ComputeV1SizeLayout(unpadded)
+		require.NoError(t, err)
+		height, padding, err := commcid.UnpaddedSizeToV1TreeHeightAndPadding(unpadded)
+		require.NoError(t, err)
+		require.Equal(t, height, layout.TreeHeight)
+		require.Equal(t, padding, layout.Padding)
+		require.Equal(t, commcid.V1TreeHeightToPaddedSize(height), layout.PaddedSize)
+		require.Equal(t, unpadded+padding, layout.UnpaddedCapacity)
+	}
+
+	_, err = commcid.ComputeV1SizeLayout(126)
+	require.EqualError(t, err, "unpadded piece size must be at least 127 bytes, got 126")
+}
+
+func TestUnpaddedSizeToV1Padding(t *testing.T) {
+	for _, unpadded := range []uint64{127, 128, 127 * 4, 127*4 + 1, 1000, fixture32GiBUnpadded} {
+		padding, err := commcid.UnpaddedSizeToV1Padding(unpadded)
+		require.NoError(t, err)
+		_, expected, err := commcid.UnpaddedSizeToV1TreeHeightAndPadding(unpadded)
+		require.NoError(t, err)
+		require.Equal(t, expected, padding, "size %d", unpadded)
+	}
+
+	padding, err := commcid.UnpaddedSizeToV1Padding(1000)
+	require.NoError(t, err)
+	require.Equal(t, uint64(16), padding)
+
+	_, err = commcid.UnpaddedSizeToV1Padding(126)
+	require.EqualError(t, err, "unpadded piece size must be at least 127 bytes, got 126")
+}
+
+func TestFr32PaddedSizeToV1TreeHeight(t *testing.T) {
+	require.Equal(t, uint8(0), commcid.Fr32PaddedSizeToV1TreeHeight(1))
+	require.Equal(t, uint8(0), commcid.Fr32PaddedSizeToV1TreeHeight(32))
+	require.Equal(t, uint8(1), commcid.Fr32PaddedSizeToV1TreeHeight(33))
+	require.Equal(t, uint8(2), commcid.Fr32PaddedSizeToV1TreeHeight(128))
+	require.Equal(t, uint8(3), commcid.Fr32PaddedSizeToV1TreeHeight(129))
+	require.Equal(t, uint8(30), commcid.Fr32PaddedSizeToV1TreeHeight(32<<30))
+}
+
+func TestPaddedSizeToV1TreeHeight(t *testing.T) {
+	testCases := []struct {
+		padded uint64
+		height uint8
+	}{
+		{32, 0},
+		{64, 1},
+		{128, 2},
+		{32 << 30, 30},
+		{1 << 63, 58},
+	}
+	for _, tc := range testCases {
+		height, err := commcid.PaddedSizeToV1TreeHeight(tc.padded)
+		require.NoError(t, err)
+		require.Equal(t, tc.height, height, "size %d", tc.padded)
+	}
+
+	for _, padded := range []uint64{0, 16, 96, 127, 32<<30 + 32} {
+		_, err := commcid.PaddedSizeToV1TreeHeight(padded)
+		require.Error(t, err, "size %d", padded)
+	}
+	_, err := commcid.PaddedSizeToV1TreeHeight(96)
+	require.EqualError(t, err, "padded size 96 must be a power of two between 32 and 9223372036854775808")
+}
+
+func TestWouldCrossHeightBoundary(t *testing.T) {
+	crosses, before, after, err := commcid.WouldCrossHeightBoundary(127, 0)
+	require.NoError(t, err)
+	require.False(t, crosses)
+	require.Equal(t, uint8(2), before)
+	require.Equal(t, uint8(2), after)
+
+	// the 128 byte padded tree holds 127 unpadded bytes; one more needs 256
+	crosses, before, after, err = commcid.WouldCrossHeightBoundary(127, 1)
+	require.NoError(t, err)
+	require.True(t, crosses)
+	require.Equal(t, uint8(2), before)
+	require.Equal(t, uint8(3), after)
+
+	crosses, _, after, err = commcid.WouldCrossHeightBoundary(128, 126)
+	require.NoError(t, err)
+	require.False(t, crosses)
+	require.Equal(t, uint8(3), after)
+
+	_, _, _, err = commcid.WouldCrossHeightBoundary(100, 100)
+	require.EqualError(t, err, "unpadded piece size must be at least 127 bytes, got 100")
+}
+
+func TestUnpaddedSizeToPaddedSize(t *testing.T) {
+	require.Zero(t, commcid.UnpaddedSizeToPaddedSize(0))
+	require.Equal(t, uint64(128), commcid.UnpaddedSizeToPaddedSize(1))
+	require.Equal(t, uint64(128), commcid.UnpaddedSizeToPaddedSize(127))
+	require.Equal(t, uint64(256), commcid.UnpaddedSizeToPaddedSize(128))
+	require.Equal(t, uint64(32<<30), commcid.UnpaddedSizeToPaddedSize(fixture32GiBUnpadded))
+	require.Equal(t, uint64(math.MaxUint64), commcid.UnpaddedSizeToPaddedSize(math.MaxUint64))
+}
+
+func TestPaddedSizeToUnpaddedSize(t *testing.T) {
+	for _, unpadded := range []uint64{0, 127, 127 * 3, fixture32GiBUnpadded} {
+		padded := commcid.UnpaddedSizeToPaddedSize(unpadded)
+		roundTripped, err := commcid.PaddedSizeToUnpaddedSize(padded)
+		require.NoError(t, err)
+		require.Equal(t, unpadded, roundTripped)
+	}
+
+	_, err := commcid.PaddedSizeToUnpaddedSize(1000)
+	require.EqualError(t, err, "padded size 1000 is not a multiple of 128")
+}
+
+func TestFr32OverheadBytes(t *testing.T) {
+	overhead, err := commcid.Fr32OverheadBytes(fixture32GiBUnpadded)
+	require.NoError(t, err)
+	require.Equal(t, uint64(32<<30/128), overhead)
+
+	// zero padding is not FR32 overhead: 128 bytes need a 256 byte tree
+	overhead, err = commcid.Fr32OverheadBytes(128)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), overhead)
+
+	// agrees with the accounting info of the equivalent v2 piece CID
+	_, _, expected, err := commcid.AccountingInfo(cid.MustParse(fixture32GiBEmptyV2))
+	require.NoError(t, err)
+	overhead, err = commcid.Fr32OverheadBytes(fixture32GiBUnpadded - 1000)
+	require.NoError(t, err)
+	require.Equal(t, expected, overhead)
+
+	_, err = commcid.Fr32OverheadBytes(126)
+	require.EqualError(t, err, "unpadded piece size must be at least 127 bytes, got 126")
+}
+
+func TestPossiblePaddedSizesForV1CID(t *testing.T) {
+	sizes, err := commcid.PossiblePaddedSizesForV1CID(cid.MustParse(fixture127OfEach0123PieceCID))
+	require.NoError(t, err)
+	require.Equal(t, []uint64{2 << 10, 8 << 20, 512 << 20, 32 << 30, 64 << 30}, sizes)
+
+	_, err = commcid.PossiblePaddedSizesForV1CID(cid.MustParse(fixture32GiBEmptyV2))
+	require.ErrorIs(t, err, commcid.ErrIncorrectCodec)
+}
+
+func TestNextPaddedPieceSize(t *testing.T) {
+	testCases := []struct {
+		unpadded uint64
+		padded   uint64
+	}{
+		{127, 128},
+		// 128 raw bytes fit in 128 padded bytes only without FR32 expansion
+		{128, 256},
+		{254, 256},
+		{255, 512},
+		{1000, 1024},
+		{1016, 1024},
+		{1017, 2048},
+		{fixture32GiBUnpadded, 32 << 30},
+		{fixture32GiBUnpadded + 1, 64 << 30},
+	}
+	for _, tc := range testCases {
+		padded, err := commcid.NextPaddedPieceSize(tc.unpadded)
+		require.NoError(t, err)
+		require.Equal(t, tc.padded, padded, "size %d", tc.unpadded)
+
+		height, err := commcid.UnpaddedSizeToV1TreeHeight(tc.unpadded)
+		require.NoError(t, err)
+		require.Equal(t, uint64(32)<<height, padded)
+	}
+
+	_, err := commcid.NextPaddedPieceSize(126)
+	require.EqualError(t, err, "unpadded piece size must be at least 127 bytes, got 126")
+}
+
+func TestV1TreeHeightToMaxUnpaddedSize(t *testing.T) {
+	require.Equal(t, uint64(31), commcid.V1TreeHeightToMaxUnpaddedSize(0))
+	require.Equal(t, uint64(63), commcid.V1TreeHeightToMaxUnpaddedSize(1))
+	require.Equal(t, uint64(127), commcid.V1TreeHeightToMaxUnpaddedSize(2))
+	require.Equal(t, uint64(fixture32GiBUnpadded), commcid.V1TreeHeightToMaxUnpaddedSize(30))
+	require.Equal(t, uint64(9151314442816847872), commcid.V1TreeHeightToMaxUnpaddedSize(58))
+	require.Zero(t, commcid.V1TreeHeightToMaxUnpaddedSize(59))
+	require.Zero(t, commcid.V1TreeHeightToMaxUnpaddedSize(63))
+
+	// the inverse of UnpaddedSizeToV1TreeHeight
+	for height := uint8(2); height <= 58; height++ {
+		maxSize := commcid.V1TreeHeightToMaxUnpaddedSize(height)
+		h, err := commcid.UnpaddedSizeToV1TreeHeight(maxSize)
+		require.NoError(t, err)
+		require.Equal(t, height, h)
+		if height > 2 {
+			h, err = commcid.UnpaddedSizeToV1TreeHeight(commcid.V1TreeHeightToMaxUnpaddedSize(height-1) + 1)
+			require.NoError(t, err)
+			require.Equal(t, height, h)
+		}
+	}
+}
+
+func TestV1TreeHeightToPaddedSize(t *testing.T) {
+	require.Equal(t, uint64(32), commcid.V1TreeHeightToPaddedSize(0))
+	require.Equal(t, uint64(128), commcid.V1TreeHeightToPaddedSize(2))
+	require.Equal(t, uint64(32<<30), commcid.V1TreeHeightToPaddedSize(30))
+	require.Equal(t, uint64(1<<63), commcid.V1TreeHeightToPaddedSize(58))
+	require.Zero(t, commcid.V1TreeHeightToPaddedSize(59))
+}
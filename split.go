@@ -0,0 +1,61 @@
+package commcid
+
+import (
+	"io"
+
+	"golang.org/x/xerrors"
+)
+
+// SplitIntoSectorPieces streams r and cuts it into consecutive pieces that each
+// fill a sector of the given padded size, returning the v1 piece CID and padded
+// size of every piece. The final piece holds whatever data remains and is only
+// as large as it needs to be; if it is shorter than the minimum piece payload it
+// is zero-filled up to it.
+func SplitIntoSectorPieces(r io.Reader, sectorSize uint64) ([]PieceInfo, error) {
+	if err := validatePaddedSize(sectorSize); err != nil {
+		return nil, err
+	}
+	capacity := sectorSize / fr32PaddedChunk * fr32UnpaddedChunk
+	buf := make([]byte, min(readChunkSize, capacity))
+
+	var pieces []PieceInfo
+	for {
+		var b PieceBuilder
+		lr := io.LimitReader(r, int64(capacity))
+		for {
+			n, err := io.ReadFull(lr, buf)
+			if b.unpadded == 0 && n > 0 && n < MinUnpaddedPieceSize {
+				clear(buf[n:MinUnpaddedPieceSize])
+				n = MinUnpaddedPieceSize
+			}
+			if n > 0 {
+				if err := b.AddData(buf[:n]); err != nil {
+					return nil, err
+				}
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			if err != nil {
+				return nil, xerrors.Errorf("reading piece data: %w", err)
+			}
+		}
+		if b.unpadded == 0 {
+			return pieces, nil
+		}
+
+		commP, _, paddedSize, err := b.Digest()
+		if err != nil {
+			return nil, err
+		}
+		c, err := PieceCommitmentV1ToCID(commP)
+		if err != nil {
+			return nil, err
+		}
+		pieces = append(pieces, PieceInfo{PieceCID: c, Size: paddedSize})
+
+		if b.unpadded < capacity {
+			return pieces, nil
+		}
+	}
+}
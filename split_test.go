@@ -0,0 +1,46 @@
+package commcid_test
+
+import (
+	"bytes"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitIntoSectorPieces(t *testing.T) {
+	pieces, err := commcid.SplitIntoSectorPieces(bytes.NewReader(bytes.Repeat(fixture127OfEach0123, 2)), 512)
+	require.NoError(t, err)
+	require.Len(t, pieces, 2)
+	for _, p := range pieces {
+		require.NoError(t, p.Validate())
+		require.Equal(t, fixture127OfEach0123PieceCID, p.PieceCID.String())
+		require.Equal(t, uint64(512), p.Size)
+	}
+
+	t.Run("final partial piece", func(t *testing.T) {
+		data := append(bytes.Repeat(fixture127OfEach0123, 2), fixture127OfEach0123[:200]...)
+		pieces, err := commcid.SplitIntoSectorPieces(bytes.NewReader(data), 512)
+		require.NoError(t, err)
+		require.Len(t, pieces, 3)
+
+		expected, expectedSize, err := commcid.PieceCIDFromReader(bytes.NewReader(fixture127OfEach0123[:200]))
+		require.NoError(t, err)
+		require.Equal(t, expected, pieces[2].PieceCID)
+		require.Equal(t, expectedSize, pieces[2].Size)
+	})
+
+	t.Run("short final piece is zero-filled", func(t *testing.T) {
+		data := append(bytes.Repeat(fixture127OfEach0123, 1), 0x00, 0x00)
+		pieces, err := commcid.SplitIntoSectorPieces(bytes.NewReader(data), 512)
+		require.NoError(t, err)
+		require.Len(t, pieces, 2)
+		require.NoError(t, pieces[1].Validate())
+		require.Equal(t, uint64(128), pieces[1].Size)
+	})
+
+	t.Run("error on invalid sector size", func(t *testing.T) {
+		_, err := commcid.SplitIntoSectorPieces(bytes.NewReader(fixture127OfEach0123), 1000)
+		require.EqualError(t, err, "padded piece size 1000 must be a power of two between 128 and 9223372036854775808")
+	})
+}
@@ -0,0 +1,200 @@
+package commcid
+
+import (
+	"io"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// StreamingPieceHasher computes a v1 piece CID from writes of any size,
+// buffering partial 127 byte chunks so the underlying PieceBuilder only ever
+// sees aligned data. The zero value is ready to use.
+type StreamingPieceHasher struct {
+	builder    PieceBuilder
+	pending    [fr32UnpaddedChunk]byte
+	pendingLen int
+	finished   bool
+	err        error
+
+	// progress tracking
+	totalSize   uint64
+	written     uint64
+	start       time.Time
+	sampleAt    time.Time
+	sampleBytes uint64
+	rate        float64
+}
+
+// rateWindow is how often the rolling throughput estimate is refreshed
+const rateWindow = time.Second
+
+var _ io.Writer = (*StreamingPieceHasher)(nil)
+
+// Write adds p to the piece. Data that would take the piece past
+// MaxUnpaddedPieceSize is rejected with ErrPieceTooLarge. Any error is sticky:
+// later writes and Finish return it too.
+func (h *StreamingPieceHasher) Write(p []byte) (int, error) {
+	if h.err != nil {
+		return 0, h.err
+	}
+	if h.finished {
+		return 0, xerrors.New("write after Finish")
+	}
+	accepted := h.builder.unpadded + uint64(h.pendingLen)
+	if uint64(len(p)) > MaxUnpaddedPieceSize-accepted {
+		h.err = xerrors.Errorf("writing %d bytes after %d: %w", len(p), accepted, ErrPieceTooLarge)
+		return 0, h.err
+	}
+	n, err := h.write(p)
+	h.trackWrite(uint64(n))
+	if err != nil {
+		h.err = err
+	}
+	return n, err
+}
+
+// write feeds p to the builder in whole chunks, returning how many bytes of p
+// were consumed
+func (h *StreamingPieceHasher) write(p []byte) (int, error) {
+	var consumed int
+	if h.pendingLen > 0 {
+		filled := copy(h.pending[h.pendingLen:], p)
+		if h.pendingLen+filled < fr32UnpaddedChunk {
+			h.pendingLen += filled
+			return filled, nil
+		}
+		if err := h.builder.AddData(h.pending[:]); err != nil {
+			return 0, err
+		}
+		h.pendingLen = 0
+		consumed, p = filled, p[filled:]
+	}
+
+	aligned := len(p) / fr32UnpaddedChunk * fr32UnpaddedChunk
+	if aligned > 0 {
+		if err := h.builder.AddData(p[:aligned]); err != nil {
+			return consumed, err
+		}
+	}
+	h.pendingLen = copy(h.pending[:], p[aligned:])
+	return consumed + len(p), nil
+}
+
+// Finish flushes any buffered data and returns the v1 piece CID and padded
+// piece size. No further writes are accepted afterwards.
+func (h *StreamingPieceHasher) Finish() (cid.Cid, uint64, error) {
+	if h.err != nil {
+		return cid.Undef, 0, h.err
+	}
+	if !h.finished {
+		h.finished = true
+		if h.pendingLen > 0 {
+			if err := h.builder.AddData(h.pending[:h.pendingLen]); err != nil {
+				h.err = err
+				return cid.Undef, 0, err
+			}
+		}
+	}
+
+	commP, _, paddedSize, err := h.builder.Digest()
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	c, err := PieceCommitmentV1ToCID(commP)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	return c, paddedSize, nil
+}
+
+// SetTotalSize declares how many bytes will be written in total, allowing
+// Progress to estimate the time remaining
+func (h *StreamingPieceHasher) SetTotalSize(totalSize uint64) {
+	h.totalSize = totalSize
+}
+
+// Progress returns how many bytes have been written, the rolling throughput in
+// bytes per second and, when the total size has been set, the estimated time
+// until it is reached. The estimate is zero if the total is unknown or no
+// throughput has been measured yet.
+func (h *StreamingPieceHasher) Progress() (uint64, float64, time.Duration) {
+	if h.start.IsZero() {
+		return 0, 0, 0
+	}
+
+	rate := h.rate
+	if rate == 0 {
+		// no full window yet, so fall back to the average so far
+		if elapsed := time.Since(h.start).Seconds(); elapsed > 0 {
+			rate = float64(h.written) / elapsed
+		}
+	}
+	if h.totalSize <= h.written || rate == 0 {
+		return h.written, rate, 0
+	}
+	remaining := float64(h.totalSize-h.written) / rate
+	return h.written, rate, time.Duration(remaining * float64(time.Second))
+}
+
+// trackWrite updates the byte count and, once per rateWindow, folds the
+// throughput of the last window into the rolling rate
+func (h *StreamingPieceHasher) trackWrite(n uint64) {
+	now := time.Now()
+	if h.start.IsZero() {
+		h.start, h.sampleAt = now, now
+	}
+	h.written += n
+
+	if elapsed := now.Sub(h.sampleAt); elapsed >= rateWindow {
+		windowRate := float64(h.written-h.sampleBytes) / elapsed.Seconds()
+		if h.rate == 0 {
+			h.rate = windowRate
+		} else {
+			h.rate = (h.rate + windowRate) / 2
+		}
+		h.sampleAt, h.sampleBytes = now, h.written
+	}
+}
+
+// PieceCIDWriter is an io.Writer that computes the v2 piece CID of everything
+// written to it, so piece data can be teed through it during an existing copy.
+// The zero value is ready to use.
+type PieceCIDWriter struct {
+	hasher StreamingPieceHasher
+	summed bool
+}
+
+var _ io.Writer = (*PieceCIDWriter)(nil)
+
+// Write adds p to the piece
+func (w *PieceCIDWriter) Write(p []byte) (int, error) {
+	if w.summed {
+		return 0, xerrors.New("write after Sum")
+	}
+	return w.hasher.Write(p)
+}
+
+// Sum returns the v2 piece CID and unpadded size of all data written. It may
+// only be called once.
+func (w *PieceCIDWriter) Sum() (cid.Cid, uint64, error) {
+	if w.summed {
+		return cid.Undef, 0, xerrors.New("Sum already called")
+	}
+	w.summed = true
+	if w.hasher.written == 0 {
+		return cid.Undef, 0, xerrors.New("no piece data written")
+	}
+
+	v1, _, err := w.hasher.Finish()
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	unpaddedSize := w.hasher.builder.unpadded
+	c, err := ConvertDataCommitmentV1V1CIDtoPieceMhCID(v1, unpaddedSize)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	return c, unpaddedSize, nil
+}
@@ -0,0 +1,118 @@
+package commcid_test
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamingPieceHasher(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		var h commcid.StreamingPieceHasher
+		for data := fixture127OfEach0123; len(data) > 0; {
+			n := min(rand.Intn(300), len(data))
+			written, err := h.Write(data[:n])
+			require.NoError(t, err)
+			require.Equal(t, n, written)
+			data = data[n:]
+		}
+
+		c, paddedSize, err := h.Finish()
+		require.NoError(t, err)
+		require.Equal(t, fixture127OfEach0123PieceCID, c.String())
+		require.Equal(t, uint64(512), paddedSize)
+	}
+
+	t.Run("error on write after finish", func(t *testing.T) {
+		var h commcid.StreamingPieceHasher
+		_, err := h.Write(fixture127OfEach0123)
+		require.NoError(t, err)
+		_, _, err = h.Finish()
+		require.NoError(t, err)
+		_, err = h.Write([]byte{1})
+		require.EqualError(t, err, "write after Finish")
+	})
+
+	t.Run("error past the maximum piece size is sticky", func(t *testing.T) {
+		var h commcid.StreamingPieceHasher
+		written, err := h.Write(fixture127OfEach0123[:100])
+		require.NoError(t, err)
+		require.Equal(t, 100, written)
+
+		h.SetAcceptedForTest(commcid.MaxUnpaddedPieceSize - 101)
+		written, err = h.Write([]byte{1, 2})
+		require.ErrorIs(t, err, commcid.ErrPieceTooLarge)
+		require.Zero(t, written)
+		processed, _, _ := h.Progress()
+		require.Equal(t, uint64(100), processed, "rejected bytes are not counted")
+
+		_, err = h.Write([]byte{1})
+		require.ErrorIs(t, err, commcid.ErrPieceTooLarge)
+		_, _, err = h.Finish()
+		require.ErrorIs(t, err, commcid.ErrPieceTooLarge)
+	})
+}
+
+func TestStreamingPieceHasherProgress(t *testing.T) {
+	var h commcid.StreamingPieceHasher
+	processed, rate, remaining := h.Progress()
+	require.Zero(t, processed)
+	require.Zero(t, rate)
+	require.Zero(t, remaining)
+
+	data := make([]byte, 127*1024)
+	h.SetTotalSize(uint64(len(data)) * 4)
+	for i := 0; i < 2; i++ {
+		_, err := h.Write(data)
+		require.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	processed, rate, remaining = h.Progress()
+	require.Equal(t, uint64(len(data))*2, processed)
+	require.Greater(t, rate, 0.0)
+	// half the input is left, at the rate the first half was written
+	require.InDelta(t, float64(len(data))*2/rate, remaining.Seconds(), 0.001)
+	require.Less(t, remaining, 10*time.Second)
+
+	t.Run("no estimate without a total size", func(t *testing.T) {
+		var h commcid.StreamingPieceHasher
+		_, err := h.Write(data)
+		require.NoError(t, err)
+		time.Sleep(time.Millisecond)
+		processed, rate, remaining := h.Progress()
+		require.Equal(t, uint64(len(data)), processed)
+		require.Greater(t, rate, 0.0)
+		require.Zero(t, remaining)
+	})
+}
+
+func TestPieceCIDWriter(t *testing.T) {
+	var w commcid.PieceCIDWriter
+	for data := fixture127OfEach0123; len(data) > 0; {
+		n := min(50, len(data))
+		written, err := w.Write(data[:n])
+		require.NoError(t, err)
+		require.Equal(t, n, written)
+		data = data[n:]
+	}
+
+	c, unpaddedSize, err := w.Sum()
+	require.NoError(t, err)
+	require.Equal(t, "bafkzcibcaaces3nobte6ezpp4wqan2age2s5yxcatzotcvobhgcmv5wi2xh5mbi", c.String())
+	require.Equal(t, uint64(508), unpaddedSize)
+
+	_, _, err = w.Sum()
+	require.EqualError(t, err, "Sum already called")
+	_, err = w.Write([]byte{1})
+	require.EqualError(t, err, "write after Sum")
+
+	t.Run("error if nothing was written", func(t *testing.T) {
+		var w commcid.PieceCIDWriter
+		_, _, err := w.Sum()
+		require.EqualError(t, err, "no piece data written")
+	})
+}
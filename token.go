@@ -0,0 +1,41 @@
+package commcid
+
+import (
+	"encoding/base64"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-varint"
+	"golang.org/x/xerrors"
+)
+
+// EncodePieceToken packs a v1 or v2 piece CID and its padded size into a
+// compact URL-safe base64 token. The size is redundant for v2 piece CIDs but
+// must match the size they encode.
+func EncodePieceToken(c cid.Cid, paddedSize uint64) (string, error) {
+	if err := validatePieceSize(c, paddedSize); err != nil {
+		return "", err
+	}
+	buf := append(varint.ToUvarint(paddedSize), c.Bytes()...)
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// DecodePieceToken unpacks a token produced by EncodePieceToken into the piece
+// CID and padded size
+func DecodePieceToken(token string) (cid.Cid, uint64, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cid.Undef, 0, xerrors.Errorf("Error decoding piece token: %w", err)
+	}
+	paddedSize, n, err := varint.FromUvarint(buf)
+	if err != nil {
+		return cid.Undef, 0, xerrors.Errorf("Error decoding piece token size: %w", err)
+	}
+	c, err := cid.Cast(buf[n:])
+	if err != nil {
+		return cid.Undef, 0, xerrors.Errorf("Error decoding piece token CID: %w", err)
+	}
+	if err := validatePieceSize(c, paddedSize); err != nil {
+		return cid.Undef, 0, err
+	}
+	return c, paddedSize, nil
+}
@@ -0,0 +1,46 @@
+package commcid_test
+
+import (
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPieceTokenRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		cid        string
+		paddedSize uint64
+	}{
+		{fixture127OfEach0123PieceCID, 512},
+		{fixture32GiBEmptyV1, 32 << 30},
+		{fixture32GiBEmptyV2, 32 << 30},
+	} {
+		token, err := commcid.EncodePieceToken(cid.MustParse(tc.cid), tc.paddedSize)
+		require.NoError(t, err)
+		require.NotContains(t, token, "=")
+		require.NotContains(t, token, "/")
+		require.NotContains(t, token, "+")
+
+		c, paddedSize, err := commcid.DecodePieceToken(token)
+		require.NoError(t, err)
+		require.Equal(t, tc.cid, c.String())
+		require.Equal(t, tc.paddedSize, paddedSize)
+	}
+
+	t.Run("error on size mismatch for v2", func(t *testing.T) {
+		_, err := commcid.EncodePieceToken(cid.MustParse(fixture32GiBEmptyV2), 64<<30)
+		require.EqualError(t, err, "padded size 68719476736 does not match the size 34359738368 encoded in piece CID")
+	})
+
+	t.Run("error on invalid padded size", func(t *testing.T) {
+		_, err := commcid.EncodePieceToken(cid.MustParse(fixture127OfEach0123PieceCID), 500)
+		require.EqualError(t, err, "padded piece size 500 must be a power of two between 128 and 9223372036854775808")
+	})
+
+	t.Run("error on malformed token", func(t *testing.T) {
+		_, _, err := commcid.DecodePieceToken("not a token!")
+		require.Regexp(t, "^Error decoding piece token:", err.Error())
+	})
+}
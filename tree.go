@@ -0,0 +1,83 @@
+package commcid
+
+import (
+	"sort"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// CommitmentFromSparseLeaves computes the merkle root of a tree of the given
+// height from a map of leaf index to 32-byte leaf node. Indices absent from
+// the map are treated as zero leaves, and any subtree without explicit leaves
+// is taken directly from the zero commitment table rather than hashed.
+func CommitmentFromSparseLeaves(leaves map[uint64][]byte, height uint8) ([]byte, error) {
+	if height > maxTreeHeight {
+		return nil, xerrors.Errorf("tree height %d exceeds maximum of %d", height, maxTreeHeight)
+	}
+
+	indices := make([]uint64, 0, len(leaves))
+	for idx, leaf := range leaves {
+		if idx>>height != 0 {
+			return nil, xerrors.Errorf("leaf index %d out of range for tree height %d", idx, height)
+		}
+		if len(leaf) != nodeSize {
+			return nil, xerrors.Errorf("leaf %d must be %d bytes long, got %d", idx, nodeSize, len(leaf))
+		}
+		indices = append(indices, idx)
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+
+	root := sparseRoot(leaves, indices, height, 0)
+	return root[:], nil
+}
+
+// sparseRoot returns the root of the subtree of the given height starting at
+// leaf offset, where indices are the sorted explicit leaves within it
+func sparseRoot(leaves map[uint64][]byte, indices []uint64, height uint8, offset uint64) [nodeSize]byte {
+	if len(indices) == 0 {
+		return zeroCommitments[height]
+	}
+	if height == 0 {
+		return [nodeSize]byte(leaves[indices[0]])
+	}
+
+	mid := offset + 1<<(height-1)
+	split := sort.Search(len(indices), func(i int) bool { return indices[i] >= mid })
+	left := sparseRoot(leaves, indices[:split], height-1, offset)
+	right := sparseRoot(leaves, indices[split:], height-1, mid)
+	return hashNodes(&left, &right)
+}
+
+// AppendZerosPieceCID returns the v2 piece CID and padded piece size that
+// result from appending zerosToAppend zero bytes to the currentUnpadded bytes
+// committed to by the v1 piece CID c. The appended zeros only ever replace
+// zero padding, so the existing root is kept and merely paired with zero
+// subtrees for every layer the tree grows by. A v2 CID is returned because it
+// records the new size: appending a few zeros often leaves the root, and so
+// the v1 CID, unchanged.
+func AppendZerosPieceCID(c cid.Cid, currentUnpadded uint64, zerosToAppend uint64) (cid.Cid, uint64, error) {
+	commP, err := CIDToPieceCommitmentV1(c)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	from, err := UnpaddedSizeToV1TreeHeight(currentUnpadded)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	if zerosToAppend > MaxUnpaddedPieceSize-currentUnpadded {
+		return cid.Undef, 0, xerrors.Errorf("appending %d bytes exceeds the maximum piece size", zerosToAppend)
+	}
+	to := paddedTreeHeight(currentUnpadded + zerosToAppend)
+
+	root := [nodeSize]byte(commP)
+	for h := from; h < to; h++ {
+		root = hashNodes(&root, &zeroCommitments[h])
+	}
+
+	grown, err := DataCommitmentV1ToPieceMhCID(root[:], currentUnpadded+zerosToAppend)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	return grown, nodeSize << to, nil
+}
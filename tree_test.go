@@ -0,0 +1,112 @@
+package commcid_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitmentFromSparseLeaves(t *testing.T) {
+	const height = 4
+
+	sparse := make(map[uint64][]byte)
+	for _, idx := range []uint64{1, 6, 7, 13} {
+		leaf := make([]byte, 32)
+		_, err := rand.Read(leaf)
+		require.NoError(t, err)
+		leaf[31] &= 0x3f
+		sparse[idx] = leaf
+	}
+
+	dense := make([][]byte, 1<<height)
+	for idx := range dense {
+		if leaf, ok := sparse[uint64(idx)]; ok {
+			dense[idx] = leaf
+		} else {
+			dense[idx] = make([]byte, 32)
+		}
+	}
+
+	root, err := commcid.CommitmentFromSparseLeaves(sparse, height)
+	require.NoError(t, err)
+	require.Equal(t, testDenseRoot(dense), root)
+
+	t.Run("empty map yields the zero commitment", func(t *testing.T) {
+		root, err := commcid.CommitmentFromSparseLeaves(nil, 6)
+		require.NoError(t, err)
+		c, err := commcid.PieceCommitmentV1ToCID(root)
+		require.NoError(t, err)
+		require.Equal(t, "baga6ea4seaqpy7usqklokfx2vxuynmupslkeutzexe2uqurdg5vhtebhxqmpqmy", c.String())
+	})
+
+	t.Run("error on out of range index", func(t *testing.T) {
+		_, err := commcid.CommitmentFromSparseLeaves(map[uint64][]byte{16: make([]byte, 32)}, height)
+		require.EqualError(t, err, "leaf index 16 out of range for tree height 4")
+	})
+
+	t.Run("error on wrong leaf length", func(t *testing.T) {
+		_, err := commcid.CommitmentFromSparseLeaves(map[uint64][]byte{3: make([]byte, 31)}, height)
+		require.EqualError(t, err, "leaf 3 must be 32 bytes long, got 31")
+	})
+}
+
+// testDenseRoot hashes a full leaf layer up to its root
+func testDenseRoot(layer [][]byte) []byte {
+	for len(layer) > 1 {
+		next := make([][]byte, len(layer)/2)
+		for i := range next {
+			sum := sha256.Sum256(append(append([]byte{}, layer[2*i]...), layer[2*i+1]...))
+			sum[31] &= 0x3f
+			next[i] = sum[:]
+		}
+		layer = next
+	}
+	return layer[0]
+}
+
+// v2 piece CIDs of 127 0x01 bytes followed by four and by five zero bytes
+const (
+	fixture127Plus4ZerosPieceCID = "bafkzcibcpmb57coayayjh2rd5axakfo5fsn53uscrcpywheqhkpwro3lzzdbmcq"
+	fixture127Plus5ZerosPieceCID = "bafkzcibcpib57coayayjh2rd5axakfo5fsn53uscrcpywheqhkpwro3lzzdbmcq"
+)
+
+func TestAppendZerosPieceCID(t *testing.T) {
+	data := bytes.Repeat([]byte{0x01}, 127)
+	base, _, err := commcid.PieceCIDFromReader(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	for _, zeros := range []uint64{0, 4, 5, 127*3 + 10, 5000} {
+		appended := append(append([]byte{}, data...), make([]byte, zeros)...)
+		commP, unpaddedSize, expectedSize, err := commcid.DataCommitmentV1FromReader(bytes.NewReader(appended))
+		require.NoError(t, err)
+		expected, err := commcid.DataCommitmentV1ToPieceMhCID(commP, unpaddedSize)
+		require.NoError(t, err)
+
+		c, paddedSize, err := commcid.AppendZerosPieceCID(base, 127, zeros)
+		require.NoError(t, err)
+		require.Equal(t, expected, c, "appending %d zeros", zeros)
+		require.Equal(t, expectedSize, paddedSize, "appending %d zeros", zeros)
+	}
+
+	t.Run("127+4 and 127+5 zeros give different CIDs", func(t *testing.T) {
+		plus4, _, err := commcid.AppendZerosPieceCID(base, 127, 4)
+		require.NoError(t, err)
+		require.Equal(t, fixture127Plus4ZerosPieceCID, plus4.String())
+		plus5, _, err := commcid.AppendZerosPieceCID(base, 127, 5)
+		require.NoError(t, err)
+		require.Equal(t, fixture127Plus5ZerosPieceCID, plus5.String())
+		require.NotEqual(t, plus4, plus5)
+
+		// both share a root, only the recorded size tells them apart
+		v1Plus4, _, err := commcid.ConvertDataCommitmentV1PieceMhCIDToV1CID(plus4)
+		require.NoError(t, err)
+		v1Plus5, _, err := commcid.ConvertDataCommitmentV1PieceMhCIDToV1CID(plus5)
+		require.NoError(t, err)
+		require.NotEqual(t, base, v1Plus4)
+		require.Equal(t, v1Plus4, v1Plus5)
+	})
+}
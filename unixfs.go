@@ -0,0 +1,165 @@
+package commcid
+
+import (
+	"bufio"
+	"context"
+	"io"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-varint"
+	"golang.org/x/xerrors"
+)
+
+// BlockGetter is the read side of a blockstore needed to walk a DAG. Any boxo
+// blockstore.Blockstore satisfies it.
+type BlockGetter interface {
+	Get(ctx context.Context, c cid.Cid) (blocks.Block, error)
+}
+
+// PieceCIDFromUnixFS computes the v1 piece CID and padded piece size of the
+// CARv1 that holds the UnixFS DAG under root. Blocks are streamed through the
+// hasher in the same depth-first order a CAR writer visits them, with repeated
+// blocks written once, so the DAG is never held in memory.
+func PieceCIDFromUnixFS(ctx context.Context, bs BlockGetter, root cid.Cid) (cid.Cid, uint64, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeCarV1(ctx, bs, root, pw))
+	}()
+
+	c, paddedSize, err := PieceCIDFromReader(pr)
+	// unblock the writer if hashing stopped before the whole CAR was consumed
+	_ = pr.Close()
+	return c, paddedSize, err
+}
+
+func writeCarV1(ctx context.Context, bs BlockGetter, root cid.Cid, w io.Writer) error {
+	bw := bufio.NewWriterSize(w, readChunkSize)
+	if err := writeCarSection(bw, carV1Header(root)); err != nil {
+		return err
+	}
+
+	seen := cid.NewSet()
+	if err := writeCarBlocks(ctx, bs, root, seen, bw); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func writeCarBlocks(ctx context.Context, bs BlockGetter, c cid.Cid, seen *cid.Set, w io.Writer) error {
+	if !seen.Visit(c) {
+		return nil
+	}
+
+	blk, err := bs.Get(ctx, c)
+	if err != nil {
+		return xerrors.Errorf("getting block %s: %w", c, err)
+	}
+	if err := writeCarSection(w, c.Bytes(), blk.RawData()); err != nil {
+		return err
+	}
+
+	switch c.Type() {
+	case cid.Raw:
+		return nil
+	case cid.DagProtobuf:
+		links, err := dagPBLinks(blk.RawData())
+		if err != nil {
+			return xerrors.Errorf("decoding block %s: %w", c, err)
+		}
+		for _, link := range links {
+			if err := writeCarBlocks(ctx, bs, link, seen, w); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return xerrors.Errorf("block %s is not a UnixFS node", c)
+	}
+}
+
+// writeCarSection writes the concatenation of parts prefixed by its uvarint
+// length
+func writeCarSection(w io.Writer, parts ...[]byte) error {
+	var size int
+	for _, p := range parts {
+		size += len(p)
+	}
+	if _, err := w.Write(varint.ToUvarint(uint64(size))); err != nil {
+		return err
+	}
+	for _, p := range parts {
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// carV1Header returns the dag-cbor encoding of {"roots": [root], "version": 1}
+func carV1Header(root cid.Cid) []byte {
+	hdr := appendCborHeader(nil, cborMajorMap, 2)
+	hdr = append(hdr, 0x65, 'r', 'o', 'o', 't', 's')
+	hdr = appendCborHeader(hdr, cborMajorArray, 1)
+	hdr = appendCborLink(hdr, root)
+	return append(hdr, 0x67, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0x01)
+}
+
+// dagPBLinks returns the CIDs of the links in an encoded dag-pb node, in order
+func dagPBLinks(data []byte) ([]cid.Cid, error) {
+	var links []cid.Cid
+	err := walkProtobuf(data, func(field uint64, payload []byte) error {
+		if field != 2 {
+			return nil
+		}
+		return walkProtobuf(payload, func(field uint64, payload []byte) error {
+			if field != 1 {
+				return nil
+			}
+			c, err := cid.Cast(payload)
+			if err != nil {
+				return err
+			}
+			links = append(links, c)
+			return nil
+		})
+	})
+	return links, err
+}
+
+// walkProtobuf calls fn for every length-delimited field in a protobuf message,
+// skipping varint fields
+func walkProtobuf(data []byte, fn func(field uint64, payload []byte) error) error {
+	for len(data) > 0 {
+		key, n, err := varint.FromUvarint(data)
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+
+		switch key & 7 {
+		case 0:
+			_, n, err := varint.FromUvarint(data)
+			if err != nil {
+				return err
+			}
+			data = data[n:]
+		case 2:
+			l, n, err := varint.FromUvarint(data)
+			if err != nil {
+				return err
+			}
+			data = data[n:]
+			if uint64(len(data)) < l {
+				return xerrors.New("truncated protobuf field")
+			}
+			if err := fn(key>>3, data[:l]); err != nil {
+				return err
+			}
+			data = data[l:]
+		default:
+			return xerrors.Errorf("unsupported protobuf wire type %d", key&7)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package commcid_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/multiformats/go-varint"
+	"github.com/stretchr/testify/require"
+)
+
+type testBlockstore map[cid.Cid]blocks.Block
+
+func (bs testBlockstore) Get(_ context.Context, c cid.Cid) (blocks.Block, error) {
+	blk, ok := bs[c]
+	if !ok {
+		return nil, cid.ErrInvalidCid{}
+	}
+	return blk, nil
+}
+
+func (bs testBlockstore) put(t *testing.T, codec uint64, data []byte) blocks.Block {
+	c, err := cid.Prefix{Version: 1, Codec: codec, MhType: multihash.SHA2_256, MhLength: -1}.Sum(data)
+	require.NoError(t, err)
+	blk, err := blocks.NewBlockWithCid(data, c)
+	require.NoError(t, err)
+	bs[c] = blk
+	return blk
+}
+
+// testDagPBNode encodes a dag-pb node with the given links and a UnixFS
+// file data field
+func testDagPBNode(links ...cid.Cid) []byte {
+	var node []byte
+	for _, l := range links {
+		link := append([]byte{0x0a}, varint.ToUvarint(uint64(len(l.Bytes())))...)
+		link = append(link, l.Bytes()...)
+		node = append(node, 0x12)
+		node = append(node, varint.ToUvarint(uint64(len(link)))...)
+		node = append(node, link...)
+	}
+	return append(node, 0x0a, 0x02, 0x08, 0x02)
+}
+
+// testCborItem is a decoded dag-cbor value: a uint64, string, []byte, slice,
+// map or cid.Cid
+type testCborItem any
+
+// testReadCbor decodes the single dag-cbor value at the start of data, covering
+// the types a CARv1 header uses, and returns it with the rest of data
+func testReadCbor(t *testing.T, data []byte) (testCborItem, []byte) {
+	require.NotEmpty(t, data)
+	major, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+	var n uint64
+	switch {
+	case info < 24:
+		n = uint64(info)
+	case info == 24:
+		n, data = uint64(data[0]), data[1:]
+	case info == 25:
+		n, data = uint64(binary.BigEndian.Uint16(data)), data[2:]
+	default:
+		t.Fatalf("unsupported cbor additional info %d", info)
+	}
+
+	switch major {
+	case 0:
+		return n, data
+	case 2:
+		return data[:n], data[n:]
+	case 3:
+		return string(data[:n]), data[n:]
+	case 4:
+		items := make([]testCborItem, n)
+		for i := range items {
+			items[i], data = testReadCbor(t, data)
+		}
+		return items, data
+	case 5:
+		m := make(map[string]testCborItem, n)
+		for i := uint64(0); i < n; i++ {
+			var k, v testCborItem
+			k, data = testReadCbor(t, data)
+			v, data = testReadCbor(t, data)
+			m[k.(string)] = v
+		}
+		return m, data
+	case 6:
+		require.Equal(t, uint64(42), n, "only CID tags are expected")
+		var raw testCborItem
+		raw, data = testReadCbor(t, data)
+		b := raw.([]byte)
+		require.Equal(t, byte(0), b[0], "CID links start with the identity multibase prefix")
+		c, err := cid.Cast(b[1:])
+		require.NoError(t, err)
+		return c, data
+	default:
+		t.Fatalf("unsupported cbor major type %d", major)
+		return nil, nil
+	}
+}
+
+// testReadCarV1 parses a CARv1 following the spec, independently of the
+// writer: sections are read with encoding/binary and go-cid, every block is
+// checked against its CID, and the header roots and blocks are returned in
+// order
+func testReadCarV1(t *testing.T, car []byte) ([]cid.Cid, []blocks.Block) {
+	r := bytes.NewReader(car)
+	readSection := func() []byte {
+		size, err := binary.ReadUvarint(r)
+		require.NoError(t, err)
+		section := make([]byte, size)
+		_, err = io.ReadFull(r, section)
+		require.NoError(t, err)
+		return section
+	}
+
+	header, rest := testReadCbor(t, readSection())
+	require.Empty(t, rest)
+	fields := header.(map[string]testCborItem)
+	require.Len(t, fields, 2)
+	require.Equal(t, uint64(1), fields["version"])
+	var roots []cid.Cid
+	for _, root := range fields["roots"].([]testCborItem) {
+		roots = append(roots, root.(cid.Cid))
+	}
+
+	var blks []blocks.Block
+	for r.Len() > 0 {
+		section := readSection()
+		n, c, err := cid.CidFromBytes(section)
+		require.NoError(t, err)
+		blk, err := blocks.NewBlockWithCid(section[n:], c)
+		require.NoError(t, err)
+		recomputed, err := c.Prefix().Sum(blk.RawData())
+		require.NoError(t, err)
+		require.Equal(t, c, recomputed, "block data must hash to its CID")
+		blks = append(blks, blk)
+	}
+	return roots, blks
+}
+
+// fixtureUnixFSCarPieceCID is the piece CID of the 597 byte CAR built by
+// TestPieceCIDFromUnixFS, computed outside this package with a bit-by-bit
+// FR32 padding and SHA256-trunc254 tree that also reproduces
+// fixture127OfEach0123PieceCID
+const fixtureUnixFSCarPieceCID = "baga6ea4seaqc3ho67i23dc5olskc4oiftzfebpcpt36oihqqjrdeab4mudxcsoi"
+
+func TestPieceCIDFromUnixFS(t *testing.T) {
+	bs := testBlockstore{}
+	leafA := bs.put(t, cid.Raw, bytes.Repeat([]byte("a"), 200))
+	leafB := bs.put(t, cid.Raw, bytes.Repeat([]byte("b"), 100))
+	// leafA is linked twice but must only appear once in the CAR
+	root := bs.put(t, cid.DagProtobuf, testDagPBNode(leafA.Cid(), leafB.Cid(), leafA.Cid()))
+
+	var car bytes.Buffer
+	require.NoError(t, commcid.WriteCarV1(context.Background(), bs, root.Cid(), &car))
+	roots, blks := testReadCarV1(t, car.Bytes())
+	require.Equal(t, []cid.Cid{root.Cid()}, roots)
+	require.Equal(t, []blocks.Block{root, leafA, leafB}, blks)
+	require.Len(t, car.Bytes(), 597)
+
+	expected, expectedSize, err := commcid.PieceCIDFromReader(bytes.NewReader(car.Bytes()))
+	require.NoError(t, err)
+
+	c, paddedSize, err := commcid.PieceCIDFromUnixFS(context.Background(), bs, root.Cid())
+	require.NoError(t, err)
+	require.Equal(t, expected, c)
+	require.Equal(t, fixtureUnixFSCarPieceCID, c.String())
+	require.Equal(t, expectedSize, paddedSize)
+	require.Equal(t, uint64(1024), paddedSize)
+
+	t.Run("error on missing block", func(t *testing.T) {
+		delete(bs, leafB.Cid())
+		_, _, err := commcid.PieceCIDFromUnixFS(context.Background(), bs, root.Cid())
+		require.ErrorContains(t, err, "getting block "+leafB.Cid().String())
+	})
+}
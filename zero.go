@@ -0,0 +1,63 @@
+package commcid
+
+import (
+	"maps"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+)
+
+// standardSectorSizes are the padded sector sizes supported by Filecoin proofs
+var standardSectorSizes = []uint64{
+	2 << 10,
+	8 << 20,
+	512 << 20,
+	32 << 30,
+	64 << 30,
+}
+
+var (
+	zeroPieceCIDsOnce sync.Once
+	zeroPieceCIDs     map[uint64]cid.Cid
+)
+
+// AllZeroPieceCIDs returns the v1 piece CID of an all-zero piece for every
+// standard padded sector size, keyed by that size. The CIDs are computed on
+// first use and cached.
+func AllZeroPieceCIDs() map[uint64]cid.Cid {
+	zeroPieceCIDsOnce.Do(func() {
+		zeroPieceCIDs = make(map[uint64]cid.Cid, len(standardSectorSizes))
+		for _, size := range standardSectorSizes {
+			c, err := PieceCommitmentV1ToCID(zeroCommitments[Fr32PaddedSizeToV1TreeHeight(size)][:])
+			if err != nil {
+				panic(err)
+			}
+			zeroPieceCIDs[size] = c
+		}
+	})
+	return maps.Clone(zeroPieceCIDs)
+}
+
+// EmptyPieceCID returns the v1 piece CID to use when there is no data. A piece
+// cannot be zero-length, so "empty" means the smallest piece possible: 127
+// zero bytes padded to 128 bytes, whose commitment is that of an all-zero
+// tree of height 2.
+func EmptyPieceCID() cid.Cid {
+	c, err := PieceCommitmentV1ToCID(zeroCommitments[Fr32PaddedSizeToV1TreeHeight(fr32PaddedChunk)][:])
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// ZeroPieceCIDV2 returns the v2 piece CID of unpaddedSize zero bytes. Zero
+// data only ever yields zero leaves, so its commitment is that of an all-zero
+// tree of the height the size occupies. unpaddedSize must be between 127 bytes
+// and the largest payload a height 58 tree holds.
+func ZeroPieceCIDV2(unpaddedSize uint64) (cid.Cid, error) {
+	height, err := UnpaddedSizeToV1TreeHeight(unpaddedSize)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return DataCommitmentV1ToPieceMhCID(zeroCommitments[height][:], unpaddedSize)
+}
@@ -0,0 +1,54 @@
+package commcid_test
+
+import (
+	"bytes"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllZeroPieceCIDs(t *testing.T) {
+	zeroCids := commcid.AllZeroPieceCIDs()
+	require.Len(t, zeroCids, 5)
+	require.Equal(t, "baga6ea4seaqpy7usqklokfx2vxuynmupslkeutzexe2uqurdg5vhtebhxqmpqmy", zeroCids[2<<10].String())
+	require.Equal(t, fixture32GiBEmptyV1, zeroCids[32<<30].String())
+	require.Equal(t, "baga6ea4seaqomqafu276g53zko4k23xzh4h4uecjwicbmvhsuqi7o4bhthhm4aq", zeroCids[64<<30].String())
+
+	// callers get their own copy of the cache
+	delete(zeroCids, 32<<30)
+	require.Contains(t, commcid.AllZeroPieceCIDs(), uint64(32<<30))
+}
+
+func TestEmptyPieceCID(t *testing.T) {
+	empty := commcid.EmptyPieceCID()
+	require.Equal(t, empty, commcid.EmptyPieceCID())
+
+	decoded, err := cid.Decode(empty.String())
+	require.NoError(t, err)
+	require.Equal(t, commcid.CommitmentTypeData, commcid.Classify(decoded))
+
+	expected, paddedSize, err := commcid.PieceCIDFromReader(bytes.NewReader(make([]byte, 127)))
+	require.NoError(t, err)
+	require.Equal(t, expected, empty)
+	require.Equal(t, uint64(128), paddedSize)
+}
+
+func TestZeroPieceCIDV2(t *testing.T) {
+	c, err := commcid.ZeroPieceCIDV2(fixture32GiBUnpadded)
+	require.NoError(t, err)
+	require.Equal(t, fixture32GiBEmptyV2, c.String())
+
+	// matches hashing the zeros, including sizes that leave padding
+	for _, size := range []uint64{127, 128, 1000, 127 * 16} {
+		c, err := commcid.ZeroPieceCIDV2(size)
+		require.NoError(t, err)
+		expected, _, err := commcid.PieceCIDV2FromReader(bytes.NewReader(make([]byte, size)))
+		require.NoError(t, err)
+		require.Equal(t, expected, c, "size %d", size)
+	}
+
+	_, err = commcid.ZeroPieceCIDV2(126)
+	require.EqualError(t, err, "unpadded piece size must be at least 127 bytes, got 126")
+}